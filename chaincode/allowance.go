@@ -0,0 +1,405 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Allowances are indexed by the wallet that grants them and the spender that can use them
+const allowanceIndex = "allowance~owner~spender"
+
+/*
+* Define the ApprovalEvent Structure, it's emitted whenever an allowance changes
+* Its fields are a stable schema for indexers, new ones may be added but never renamed
+* [Owner] <-- Wallet that granted the allowance
+* [Spender] <-- Identity that can spend it
+* [Amount] <-- Allowance the spender is left with
+* [TxID] <-- Transaction that changed the allowance
+ */
+type ApprovalEvent struct {
+	Owner   string `json:"owner"`
+	Spender string `json:"spender"`
+	Amount  string `json:"amount"`
+	TxID    string `json:"txId"`
+}
+
+/*
+* readAllowance
+* This method returns how much a spender can still move out of a wallet, zero when nothing was approved
+ */
+
+func readAllowance(stub shim.ChaincodeStubInterface, owner string, spender string) (*big.Int, error) {
+	allowanceKey, err := stub.CreateCompositeKey(allowanceIndex, []string{owner, spender})
+	if err != nil {
+		return nil, err
+	}
+
+	allowanceAsBytes, err := stub.GetState(allowanceKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get allowance: %s", err.Error())
+	} else if allowanceAsBytes == nil {
+		return new(big.Int), nil
+	}
+
+	allowance, ok := new(big.Int).SetString(string(allowanceAsBytes), 10)
+	if !ok {
+		return nil, fmt.Errorf("allowance %s is not a whole number", allowanceAsBytes)
+	}
+	return allowance, nil
+}
+
+/*
+* writeAllowance
+* This method saves how much a spender can move out of a wallet
+ */
+
+func writeAllowance(stub shim.ChaincodeStubInterface, owner string, spender string, amount *big.Int) error {
+	allowanceKey, err := stub.CreateCompositeKey(allowanceIndex, []string{owner, spender})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(allowanceKey, []byte(amount.String()))
+}
+
+/*
+* emitApproval
+* This method sets the ApprovalEvent of the transaction with the allowance a spender is left with
+ */
+
+func emitApproval(stub shim.ChaincodeStubInterface, owner string, spender string, amount *big.Int, decimals int) error {
+	eventAsBytes, err := json.Marshal(ApprovalEvent{Owner: owner, Spender: spender, Amount: formatAmount(amount, decimals), TxID: stub.GetTxID()})
+	if err != nil {
+		return err
+	}
+	return stub.SetEvent("ApprovalEvent", eventAsBytes)
+}
+
+/*
+* approve
+* This method lets a spender move up to an amount of money out of a wallet
+* [owner]	= This is the id for the wallet granting the allowance
+* [spender]	= This is the identity that can spend it
+* [amount]	= This is the maximum amount of money, zero revokes the allowance
+ */
+
+func (t *SimpleChaincode) approve(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//		 0			1			2
+	//		owner	 spender	  amount
+
+	if err := requireArgs("approve", args, 3); err != nil {
+		return errorFromErr(err)
+	}
+
+	owner := args[0]
+	spender := args[1]
+	if err := requireNonEmpty(args[:2]...); err != nil {
+		return errorFromErr(err)
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	amount, err := parseAmount(args[2], config.Decimals)
+	if err != nil {
+		return errorJSON(codeBadRequest, "Failed to parse into Integer, 3rd Argument must be a numeric string: "+err.Error())
+	}
+	if amount.Sign() < 0 {
+		return errorJSON(codeBadRequest, "allowance can't be negative")
+	}
+
+	wallet, err := getWallet(stub, owner)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	//Granting an allowance is as sensitive as transfering, so it follows the same rule
+	callerID, err := getCallerID(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if config.EnforceOwnerAuth && callerID != wallet.Owner {
+		return errorJSON(codeForbidden, "caller is not the wallet owner")
+	}
+
+	err = writeAllowance(stub, owner, spender, amount)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = emitApproval(stub, owner, spender, amount, config.Decimals)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Println(" - END approve - ")
+	return successJSON(stub, nil)
+}
+
+/*
+* allowance
+* This method returns how much a spender can still move out of a wallet
+* [owner]	= This is the id for the wallet that granted the allowance
+* [spender]	= This is the identity that can spend it
+* (JSON)	= JSON Document with the remaining allowance
+ */
+
+func (t *SimpleChaincode) allowance(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("allowance", args, 2); err != nil {
+		return errorFromErr(err)
+	}
+
+	remaining, err := readAllowance(stub, args[0], args[1])
+	if err != nil {
+		return errorFromErr(err)
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	return allowanceJSON(stub, remaining, config.Decimals)
+}
+
+/*
+* increaseAllowance
+* This method raises the allowance of a spender by an amount, so it can't be front-run like a new approve
+* [owner]	= This is the id for the wallet granting the allowance
+* [spender]	= This is the identity that can spend it
+* [delta]	= This is the amount of money added to the allowance
+* (JSON)	= JSON Document with the new allowance
+ */
+
+func (t *SimpleChaincode) increaseAllowance(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return adjustAllowance(stub, args, "increaseAllowance", 1)
+}
+
+/*
+* decreaseAllowance
+* This method lowers the allowance of a spender by an amount, an allowance never goes below zero
+* [owner]	= This is the id for the wallet that granted the allowance
+* [spender]	= This is the identity that can spend it
+* [delta]	= This is the amount of money taken off the allowance
+* (JSON)	= JSON Document with the new allowance
+ */
+
+func (t *SimpleChaincode) decreaseAllowance(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return adjustAllowance(stub, args, "decreaseAllowance", -1)
+}
+
+/*
+* adjustAllowance
+* This method moves an allowance up or down relative to what's stored and emits an ApprovalEvent
+* [sign]	= This is 1 to increase the allowance, -1 to decrease it
+ */
+
+func adjustAllowance(stub shim.ChaincodeStubInterface, args []string, op string, sign int) pb.Response {
+	//		 0			1			2
+	//		owner	 spender	  delta
+
+	if err := requireArgs(op, args, 3); err != nil {
+		return errorFromErr(err)
+	}
+
+	owner := args[0]
+	spender := args[1]
+	if err := requireNonEmpty(args[:2]...); err != nil {
+		return errorFromErr(err)
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	delta, err := parseAmount(args[2], config.Decimals)
+	if err != nil {
+		return errorJSON(codeBadRequest, "Failed to parse into Integer, 3rd Argument must be a numeric string: "+err.Error())
+	}
+	if delta.Sign() < 0 {
+		return errorJSON(codeBadRequest, "allowance change can't be negative")
+	}
+
+	wallet, err := getWallet(stub, owner)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	//Changing an allowance follows the same rule as granting it
+	callerID, err := getCallerID(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if config.EnforceOwnerAuth && callerID != wallet.Owner {
+		return errorJSON(codeForbidden, "caller is not the wallet owner")
+	}
+
+	allowance, err := readAllowance(stub, owner, spender)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if sign < 0 {
+		allowance = new(big.Int).Sub(allowance, delta)
+		if allowance.Sign() < 0 {
+			allowance = new(big.Int)
+		}
+	} else {
+		allowance = new(big.Int).Add(allowance, delta)
+	}
+
+	err = writeAllowance(stub, owner, spender, allowance)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	err = emitApproval(stub, owner, spender, allowance, config.Decimals)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Println(" - END " + op + " - ")
+	return allowanceJSON(stub, allowance, config.Decimals)
+}
+
+/*
+* allowanceJSON
+* This method answers with the allowance a spender is left with, as a decimal string in the configured decimals
+ */
+
+func allowanceJSON(stub shim.ChaincodeStubInterface, allowance *big.Int, decimals int) pb.Response {
+	allowanceAsBytes, err := json.Marshal(struct {
+		Allowance string `json:"allowance"`
+	}{formatAmount(allowance, decimals)})
+	if err != nil {
+		return errorFromErr(err)
+	}
+	return successJSON(stub, allowanceAsBytes)
+}
+
+/*
+* transferFrom
+* This method moves money out of a wallet on behalf of its owner, using up the allowance of the spender
+* [spender]	= This is the identity spending the allowance, it must be the caller
+* [owner]	= This is the id for the wallet that's sending money
+* [to]		= This is the id for the wallet that's receiving money
+* [amount]	= This is the amount of money that it's being transfered
+* (JSON)	= JSON Document with the receipt, carrying the txid and both new balances
+ */
+
+func (t *SimpleChaincode) transferFrom(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//		 0			1		2		3
+	//	 spender	  owner		to	  amount
+
+	if err := requireArgs("transferFrom", args, 4); err != nil {
+		return errorFromErr(err)
+	}
+
+	spender := args[0]
+	owner := args[1]
+	to := args[2]
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	amount, err := parseAmount(args[3], config.Decimals)
+	if err != nil {
+		return errorJSON(codeBadRequest, "Failed to parse into Integer, 4th Argument must be a numeric string: "+err.Error())
+	}
+
+	//An allowance can only be spent by the identity it was granted to
+	callerID, err := getCallerID(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if callerID != spender {
+		return errorJSON(codeForbidden, "caller is not the spender of the allowance")
+	}
+
+	remaining, err := readAllowance(stub, owner, spender)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if remaining.Cmp(amount) < 0 {
+		return errorJSON(codeInsufficientFunds, "Insufficient allowance")
+	}
+
+	walletFrom, err := getWallet(stub, owner)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	walletTo, err := getWallet(stub, to)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	treasury, err := loadTreasury(stub, config, &walletFrom, &walletTo)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	//The allowance stands in for the signature of the owner
+	fromBalance := walletFrom.Balance
+	toBalance := walletTo.Balance
+	fee, err := applyTransfer(config, walletFrom.Owner, &walletFrom, &walletTo, treasury, amount, "")
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = spendDailyLimit(stub, owner, amount, config.Decimals)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	err = putWallet(stub, walletTo)
+	if err != nil {
+		return errorJSON(codeInternal, "Error saving the state of wallet [T] "+to+": "+err.Error())
+	}
+	err = putWallet(stub, walletFrom)
+	if err != nil {
+		return errorJSON(codeInternal, "Error saving the state of wallet [F] "+owner+": "+err.Error())
+	}
+	err = reindexWallet(stub, toBalance, walletTo)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = reindexWallet(stub, fromBalance, walletFrom)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = writeAllowance(stub, owner, spender, new(big.Int).Sub(remaining, amount))
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	err = appendChangeLog(stub, owner, "transferFrom", new(big.Int).Neg(new(big.Int).Add(amount, fee)))
+	if err != nil {
+		return errorFromErr(err)
+	}
+	toDelta := amount
+	if treasury == &walletTo {
+		toDelta = new(big.Int).Add(amount, fee)
+	}
+	err = appendChangeLog(stub, to, "transferFrom", toDelta)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	err = creditTreasury(stub, treasury, &walletFrom, &walletTo, fee)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	receipt := TransferReceipt{
+		TransferEvent: TransferEvent{From: owner, To: to, Amount: formatAmount(amount, config.Decimals), TxID: stub.GetTxID()},
+		Fee:           formatAmount(fee, config.Decimals),
+		FromBalance:   formatAmount(walletFrom.Balance, config.Decimals),
+		ToBalance:     formatAmount(walletTo.Balance, config.Decimals),
+	}
+	//The receipt carries the txid and both resulting balances back to the caller
+	receiptAsBytes, err := recordTransfer(stub, receipt)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Println(" - END transferFrom - ")
+	return successJSON(stub, receiptAsBytes)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestAllowance(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	carol := s.createWallet("carol", "0")
+	bob := s.idOf("bob")
+
+	s.ok("approve", alice, bob, "100")
+	s.as("bob").ok("transferFrom", bob, alice, carol, "40")
+	s.expectBalance(alice, "60")
+	s.expectBalance(carol, "40")
+
+	remaining := struct {
+		Allowance string `json:"allowance"`
+	}{}
+	decode(t, s.ok("allowance", alice, bob).Data, &remaining)
+	if remaining.Allowance != "60" {
+		t.Fatalf("allowance is %s after a partial spend", remaining.Allowance)
+	}
+
+	expectMessage(t, s.as("bob").fails(codeInsufficientFunds, "transferFrom", bob, alice, carol, "70"), "Insufficient allowance")
+	expectMessage(t, s.as("carol").fails(codeForbidden, "transferFrom", bob, alice, carol, "10"), "caller is not the spender")
+	s.fails(codeBadRequest, "approve", alice, bob, "-1")
+	s.expectBalance(alice, "60")
+
+	//Approving again replaces the allowance instead of adding to it
+	s.ok("approve", alice, bob, "5")
+	s.as("bob").fails(codeInsufficientFunds, "transferFrom", bob, alice, carol, "6")
+	s.as("bob").ok("transferFrom", bob, alice, carol, "5")
+	s.expectBalance(alice, "55")
+}
+
+func TestAdjustAllowance(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.idOf("bob")
+	s.ok("approve", alice, bob, "60")
+
+	remaining := struct {
+		Allowance string `json:"allowance"`
+	}{}
+	decode(t, s.ok("increaseAllowance", alice, bob, "10").Data, &remaining)
+	if remaining.Allowance != "70" {
+		t.Fatalf("increaseAllowance left %s", remaining.Allowance)
+	}
+
+	//Decreasing past zero clamps the allowance at zero
+	decode(t, s.ok("decreaseAllowance", alice, bob, "100").Data, &remaining)
+	if remaining.Allowance != "0" {
+		t.Fatalf("decreaseAllowance left %s", remaining.Allowance)
+	}
+	s.as("bob").fails(codeInsufficientFunds, "transferFrom", bob, alice, s.createWallet("carol", "0"), "1")
+	s.fails(codeBadRequest, "increaseAllowance", alice, bob, "-1")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Amounts are arbitrary precision, but more decimals than this are a configuration mistake
+const maxDecimals = 18
+
+/*
+* Amounts of money are *big.Int so balances and supply can grow past 64 bits
+* They're shared between wallets, receipts and logs, so they're never changed in place:
+* every operation stores a fresh value, e.g. wallet.Balance = new(big.Int).Add(wallet.Balance, amount)
+ */
+
+/*
+* parseAmount
+* This method turns a decimal amount like "10.50" into minor units, so with 2 decimals it returns 1050
+* [value]	= This is the amount as the client sent it
+* [decimals]	= This is the amount of decimals the config allows
+ */
+
+func parseAmount(value string, decimals int) (*big.Int, error) {
+	whole := value
+	fraction := ""
+	if dot := strings.Index(value, "."); dot >= 0 {
+		whole = value[:dot]
+		fraction = value[dot+1:]
+		if len(fraction) == 0 || strings.IndexFunc(fraction, func(r rune) bool { return r < '0' || r > '9' }) >= 0 {
+			return nil, fmt.Errorf("%q is not a valid amount", value)
+		}
+	}
+	if len(fraction) > decimals {
+		return nil, newError(codeBadRequest, "%q has more than %d decimal places", value, decimals)
+	}
+	if whole == "" || whole == "-" {
+		whole += "0"
+	}
+
+	//Padding the fraction out to every decimal leaves a plain integer of minor units
+	amount, ok := new(big.Int).SetString(whole+fraction+strings.Repeat("0", decimals-len(fraction)), 10)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a valid amount", value)
+	}
+	return amount, nil
+}
+
+/*
+* formatAmount
+* This method turns minor units back into a decimal amount, so 1050 with 2 decimals becomes "10.50"
+* [amount]	= This is the amount in minor units
+* [decimals]	= This is the amount of decimals the config allows
+ */
+
+func formatAmount(amount *big.Int, decimals int) string {
+	digits := amount.String()
+	if decimals <= 0 {
+		return digits
+	}
+
+	sign := ""
+	if amount.Sign() < 0 {
+		sign = "-"
+		digits = digits[1:]
+	}
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-decimals] + "." + digits[len(digits)-decimals:]
+}
+
+/*
+* amountOf
+* This method turns plain whole numbers, like percents and basis points, into big amounts
+ */
+
+func amountOf(amount int) *big.Int {
+	return big.NewInt(int64(amount))
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestAmountHelpers(t *testing.T) {
+	for _, test := range []struct {
+		value    string
+		decimals int
+		minor    string
+	}{
+		{"10.50", 2, "1050"},
+		{"0.01", 2, "1"},
+		{".5", 2, "50"},
+		{"7", 2, "700"},
+		{"-1.5", 2, "-150"},
+		{"100", 0, "100"},
+		{"123456789012345678901234567890", 0, "123456789012345678901234567890"},
+	} {
+		amount, err := parseAmount(test.value, test.decimals)
+		if err != nil || amount.String() != test.minor {
+			t.Fatalf("parseAmount(%q, %d) returned %v, %v", test.value, test.decimals, amount, err)
+		}
+	}
+	for _, value := range []string{"1.001", "abc", "1.", "1.a", "1e5", "0x10"} {
+		if amount, err := parseAmount(value, 2); err == nil {
+			t.Fatalf("parseAmount(%q, 2) accepted it as %s", value, amount)
+		}
+	}
+
+	for _, test := range []struct {
+		minor    int64
+		decimals int
+		value    string
+	}{
+		{1050, 2, "10.50"},
+		{1, 2, "0.01"},
+		{0, 2, "0.00"},
+		{-150, 2, "-1.50"},
+		{100, 0, "100"},
+	} {
+		if got := formatAmount(big.NewInt(test.minor), test.decimals); got != test.value {
+			t.Fatalf("formatAmount(%d, %d) returned %s", test.minor, test.decimals, got)
+		}
+	}
+}
+
+func TestDecimals(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY", Decimals: 2})
+	alice := s.createWallet("alice", "10.50")
+	bob := s.createWallet("bob", "0")
+
+	//Balances are stored in minor units
+	s.expectBalance(alice, "1050")
+	s.ok("transferFunds", alice, bob, "0.01")
+	s.expectBalance(bob, "1")
+
+	balance := struct {
+		Balance string `json:"balance"`
+	}{}
+	decode(t, s.ok("getBalance", alice).Data, &balance)
+	if balance.Balance != "10.49" {
+		t.Fatalf("getBalance returned %s instead of 10.49", balance.Balance)
+	}
+
+	expectMessage(t, s.fails(codeBadRequest, "transferFunds", alice, bob, "0.001"), "has more than 2 decimal places")
+	s.fails(codeBadRequest, "initWallet", addressOf("carol"), "1.234")
+	s.expectBalance(alice, "1049")
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strconv"
+)
+
+/*
+* requireArgs
+* This method checks a handler received exactly the amount of arguments it expects
+* [function]	= This is the name of the handler, so the error says who complained
+* [args]	= This is the list of arguments the handler received
+* [n]		= This is the amount of arguments the handler expects
+ */
+
+func requireArgs(function string, args []string, n int) error {
+	if len(args) != n {
+		return newError(codeBadRequest, "%s: Incorrect number of arguments. Expecting %d, got %d", function, n, len(args))
+	}
+	return nil
+}
+
+/*
+* requireArgsBetween
+* This method checks a handler with optional arguments received an amount of arguments it accepts
+* [function]	= This is the name of the handler, so the error says who complained
+* [args]	= This is the list of arguments the handler received
+* [min]		= This is the amount of required arguments
+* [max]		= This is the amount of required and optional arguments
+ */
+
+func requireArgsBetween(function string, args []string, min int, max int) error {
+	if len(args) < min || len(args) > max {
+		return newError(codeBadRequest, "%s: Incorrect number of arguments. Expecting %d to %d, got %d", function, min, max, len(args))
+	}
+	return nil
+}
+
+/*
+* requireNonEmpty
+* This method checks none of the given arguments is an empty string
+* [args]	= These are the arguments to check, in the order the handler received them
+ */
+
+func requireNonEmpty(args ...string) error {
+	for i, arg := range args {
+		if len(arg) <= 0 {
+			return newError(codeBadRequest, "%s Argument can't be empty", ordinal(i+1))
+		}
+	}
+	return nil
+}
+
+/*
+* ordinal
+* This method spells a position the way the argument errors do, e.g. 1st, 2nd, 3rd, 4th
+ */
+
+func ordinal(n int) string {
+	suffix := "th"
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+	return strconv.Itoa(n) + suffix
+}
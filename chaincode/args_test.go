@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestArgumentHelpers(t *testing.T) {
+	for _, test := range []struct {
+		args    []string
+		n       int
+		message string
+	}{
+		{[]string{"a"}, 1, ""},
+		{[]string{}, 0, ""},
+		{[]string{}, 1, "f: Incorrect number of arguments. Expecting 1, got 0"},
+		{[]string{"a", "b"}, 1, "f: Incorrect number of arguments. Expecting 1, got 2"},
+	} {
+		err := requireArgs("f", test.args, test.n)
+		if test.message == "" && err != nil || test.message != "" && (err == nil || err.Error() != test.message || errorCode(err) != codeBadRequest) {
+			t.Fatalf("requireArgs(%v, %d) returned %v", test.args, test.n, err)
+		}
+	}
+
+	for _, test := range []struct {
+		args     []string
+		min, max int
+		ok       bool
+	}{
+		{[]string{"a"}, 1, 2, true},
+		{[]string{"a", "b"}, 1, 2, true},
+		{[]string{}, 1, 2, false},
+		{[]string{"a", "b", "c"}, 1, 2, false},
+	} {
+		err := requireArgsBetween("f", test.args, test.min, test.max)
+		if (err == nil) != test.ok {
+			t.Fatalf("requireArgsBetween(%v, %d, %d) returned %v", test.args, test.min, test.max, err)
+		}
+	}
+
+	for _, test := range []struct {
+		args    []string
+		message string
+	}{
+		{[]string{"a", "b"}, ""},
+		{[]string{"", "b"}, "1st Argument can't be empty"},
+		{[]string{"a", ""}, "2nd Argument can't be empty"},
+		{[]string{"a", "b", ""}, "3rd Argument can't be empty"},
+	} {
+		err := requireNonEmpty(test.args...)
+		if test.message == "" && err != nil || test.message != "" && (err == nil || err.Error() != test.message) {
+			t.Fatalf("requireNonEmpty(%q) returned %v", test.args, err)
+		}
+	}
+
+	for n, expected := range map[int]string{1: "1st", 2: "2nd", 3: "3rd", 4: "4th", 11: "11th", 12: "12th", 13: "13th", 21: "21st", 22: "22nd", 111: "111th"} {
+		if got := ordinal(n); got != expected {
+			t.Fatalf("ordinal(%d) returned %s", n, got)
+		}
+	}
+}
+
+func TestArgumentCountErrors(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+
+	expectMessage(t, s.fails(codeBadRequest, "transferFunds", addressOf("alice")), "transferFunds: Incorrect number of arguments. Expecting 3 to 4, got 1")
+	expectMessage(t, s.fails(codeBadRequest, "getBalance"), "getBalance: Incorrect number of arguments. Expecting 1, got 0")
+	expectMessage(t, s.fails(codeBadRequest, "queryWallet", "a", "b"), "readWallet: Incorrect number of arguments. Expecting 1, got 2")
+}
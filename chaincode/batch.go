@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+* Define the TransferRequest Structure, it's one of the transfers of a batch
+* [From] <-- Wallet that's sending money
+* [To] <-- Wallet that's receiving money
+* [Amount] <-- Amount of money being transfered, in the configured decimals
+* [Memo] <-- (Optional) Reason for the transfer
+ */
+type TransferRequest struct {
+	From   string      `json:"from"`
+	To     string      `json:"to"`
+	Amount json.Number `json:"amount"`
+	Memo   string      `json:"memo"`
+}
+
+/*
+* batchTransfer
+* This method applies several transfers in one transaction, if any of them is invalid none gets applied
+* [transfers]	= This is a JSON Array of {from, to, amount, memo} objects
+ */
+
+func (t *SimpleChaincode) batchTransfer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("batchTransfer", args, 1); err != nil {
+		return errorFromErr(err)
+	}
+
+	transfers := []TransferRequest{}
+	err := json.Unmarshal([]byte(args[0]), &transfers)
+	if err != nil {
+		return errorJSON(codeBadRequest, "1st Argument must be a JSON Array of transfers: "+err.Error())
+	}
+	if len(transfers) == 0 {
+		return errorJSON(codeBadRequest, "The batch has no transfers")
+	}
+
+	err = applyTransfers(stub, transfers, "batchTransfer")
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Printf(" - END batchTransfer (%d transfers) - \n", len(transfers))
+	return successJSON(stub, nil)
+}
+
+/*
+* transferBatch
+* This method sends money from one wallet to many in one transaction, either every payment goes through or none does
+* [from]		= This is the id for the wallet that's sending money
+* [payments]	= This is a JSON Array of {to, amount, memo} objects
+ */
+
+func (t *SimpleChaincode) transferBatch(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//		 0			1
+	//		from	 payments
+
+	if err := requireArgs("transferBatch", args, 2); err != nil {
+		return errorFromErr(err)
+	}
+
+	from := args[0]
+	transfers := []TransferRequest{}
+	err := json.Unmarshal([]byte(args[1]), &transfers)
+	if err != nil {
+		return errorJSON(codeBadRequest, "2nd Argument must be a JSON Array of payments: "+err.Error())
+	}
+	if len(transfers) == 0 {
+		return errorJSON(codeBadRequest, "The batch has no payments")
+	}
+
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	//The sender has to cover the whole batch before anything is looked at
+	total := new(big.Int)
+	for i := range transfers {
+		transfers[i].From = from
+		amount, err := parseTransferAmount(transfers[i], config.Decimals)
+		if err != nil {
+			return errorJSON(codeBadRequest, fmt.Sprintf("Payment %d of the batch is invalid: %s", i, err.Error()))
+		}
+		total.Add(total, amount)
+	}
+
+	wallet, err := getWallet(stub, from)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if wallet.Balance.Cmp(total) < 0 {
+		return errorJSON(codeInsufficientFunds, fmt.Sprintf("Insufficient funds, the batch needs %s", formatAmount(total, config.Decimals)))
+	}
+
+	err = applyTransfers(stub, transfers, "transferBatch")
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Printf(" - END transferBatch (%d payments) - \n", len(transfers))
+	return successJSON(stub, nil)
+}
+
+/*
+* applyTransfers
+* This method validates a list of transfers in memory and only saves the wallets once all of them are valid
+* Each transfer gets its own receipt, and the whole batch is emitted as a single BatchTransferEvent
+* The ledger doesn't return our own writes until the transaction is committed, so the math can't be done on it
+ */
+
+func applyTransfers(stub shim.ChaincodeStubInterface, transfers []TransferRequest, op string) error {
+	config, err := getConfig(stub)
+	if err != nil {
+		return err
+	}
+	callerID, err := getCallerID(stub)
+	if err != nil {
+		return err
+	}
+
+	receipts := []TransferReceipt{}
+	wallets := map[string]*Wallet{}
+	addresses := []string{}
+	deltas := map[string]*big.Int{}
+	sent := map[string]*big.Int{}
+	loadWallet := func(address string) (*Wallet, error) {
+		if wallet, ok := wallets[address]; ok {
+			return wallet, nil
+		}
+		wallet, err := getWallet(stub, address)
+		if err != nil {
+			return nil, err
+		}
+		wallets[address] = &wallet
+		addresses = append(addresses, address)
+		deltas[address] = new(big.Int)
+		return &wallet, nil
+	}
+
+	for i, transfer := range transfers {
+		amount, err := parseTransferAmount(transfer, config.Decimals)
+		if err != nil {
+			return newError(codeBadRequest, "Transfer %d of the batch is invalid: %s", i, err.Error())
+		}
+		from, err := loadWallet(transfer.From)
+		if err != nil {
+			return newError(errorCode(err), "Transfer %d of the batch is invalid: %s", i, err.Error())
+		}
+		to, err := loadWallet(transfer.To)
+		if err != nil {
+			return newError(errorCode(err), "Transfer %d of the batch is invalid: %s", i, err.Error())
+		}
+
+		var treasury *Wallet
+		if config.Treasury != "" {
+			treasury, err = loadWallet(config.Treasury)
+			if err != nil {
+				return newError(errorCode(err), "Failed to load the treasury: %s", err.Error())
+			}
+		}
+
+		memo := strings.TrimSpace(transfer.Memo)
+		fee, err := applyTransfer(config, callerID, from, to, treasury, amount, memo)
+		if err != nil {
+			return newError(errorCode(err), "Transfer %d of the batch is invalid: %s", i, err.Error())
+		}
+		receipts = append(receipts, TransferReceipt{
+			TransferEvent: TransferEvent{From: transfer.From, To: transfer.To, Amount: formatAmount(amount, config.Decimals), Memo: memo, TxID: stub.GetTxID()},
+			Fee:           formatAmount(fee, config.Decimals),
+			FromBalance:   formatAmount(from.Balance, config.Decimals),
+			ToBalance:     formatAmount(to.Balance, config.Decimals),
+		})
+		deltas[transfer.From].Sub(deltas[transfer.From], new(big.Int).Add(amount, fee))
+		if sent[transfer.From] == nil {
+			sent[transfer.From] = new(big.Int)
+		}
+		sent[transfer.From].Add(sent[transfer.From], amount)
+		deltas[transfer.To].Add(deltas[transfer.To], amount)
+		if fee.Sign() > 0 {
+			deltas[config.Treasury].Add(deltas[config.Treasury], fee)
+		}
+	}
+
+	//The whole batch counts against the daily limit of every sender
+	for _, address := range addresses {
+		if sent[address] == nil {
+			continue
+		}
+		err = spendDailyLimit(stub, address, sent[address], config.Decimals)
+		if err != nil {
+			return err
+		}
+	}
+
+	//Every transfer is valid, so now the Wallets are saved in the order they were first seen
+	for _, address := range addresses {
+		err = putWallet(stub, *wallets[address])
+		if err != nil {
+			return fmt.Errorf("Error saving the state of wallet %s: %s", address, err.Error())
+		}
+		err = reindexWallet(stub, new(big.Int).Sub(wallets[address].Balance, deltas[address]), *wallets[address])
+		if err != nil {
+			return err
+		}
+		err = appendChangeLog(stub, address, op, deltas[address])
+		if err != nil {
+			return err
+		}
+	}
+
+	//Every transfer leaves a receipt under tx~<txid>~<index>, and Fabric only keeps one event
+	//per transaction, so all of them go out together as a BatchTransferEvent
+	events := []TransferEvent{}
+	for i := range receipts {
+		_, err = saveReceipt(stub, &receipts[i], receipts[i].TxID, strconv.Itoa(i))
+		if err != nil {
+			return err
+		}
+		events = append(events, receipts[i].TransferEvent)
+	}
+	eventsAsBytes, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	return stub.SetEvent("BatchTransferEvent", eventsAsBytes)
+}
+
+/*
+* parseTransferAmount
+* This method reads the amount of a transfer of a batch the same way single transfers read theirs
+ */
+
+func parseTransferAmount(transfer TransferRequest, decimals int) (*big.Int, error) {
+	if transfer.Amount == "" {
+		return nil, fmt.Errorf("transfer amount is missing")
+	}
+	amount, err := parseAmount(transfer.Amount.String(), decimals)
+	if err != nil {
+		return nil, err
+	}
+	if amount.Sign() <= 0 {
+		return nil, fmt.Errorf("transfer amount must be positive")
+	}
+	return amount, nil
+}
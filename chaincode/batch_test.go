@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestBatchTransfer(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "0")
+	carol := s.createWallet("carol", "0")
+
+	batch := fmt.Sprintf("[{\"from\":%q,\"to\":%q,\"amount\":40},{\"from\":%q,\"to\":%q,\"amount\":40},{\"from\":%q,\"to\":%q,\"amount\":5}]", alice, bob, alice, carol, bob, carol)
+	s.ok("batchTransfer", batch)
+	s.expectBalance(alice, "20")
+	s.expectBalance(bob, "35")
+	s.expectBalance(carol, "45")
+
+	//The third transfer can't be covered, so none of them is applied
+	batch = fmt.Sprintf("[{\"from\":%q,\"to\":%q,\"amount\":10},{\"from\":%q,\"to\":%q,\"amount\":5},{\"from\":%q,\"to\":%q,\"amount\":10}]", alice, bob, alice, carol, alice, bob)
+	expectMessage(t, s.fails(codeInsufficientFunds, "batchTransfer", batch), "Transfer 2 of the batch is invalid")
+	s.expectBalance(alice, "20")
+	s.expectBalance(bob, "35")
+	s.expectBalance(carol, "45")
+}
+
+func TestBatchTransferReceipts(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "0")
+	carol := s.createWallet("carol", "0")
+
+	batch := fmt.Sprintf("[{\"from\":%q,\"to\":%q,\"amount\":40,\"memo\":\" rent \"},{\"from\":%q,\"to\":%q,\"amount\":15}]", alice, bob, bob, carol)
+	txID := s.ok("batchTransfer", batch).TxID
+
+	events := []TransferEvent{}
+	s.expectEvent("BatchTransferEvent", &events)
+	expected := []TransferEvent{
+		{From: alice, To: bob, Amount: "40", Memo: "rent", TxID: txID},
+		{From: bob, To: carol, Amount: "15", TxID: txID},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("unexpected events %+v", events)
+	}
+
+	//Every leg keeps its own receipt with the balances it left behind
+	for i, balances := range [][2]string{{"60", "40"}, {"25", "15"}} {
+		receipt := TransferReceipt{}
+		decode(t, s.State[s.compositeKey(transferRecordIndex, txID, strconv.Itoa(i))], &receipt)
+		if receipt.TransferEvent != expected[i] || receipt.FromBalance != balances[0] || receipt.ToBalance != balances[1] || receipt.Fee != "0" {
+			t.Fatalf("unexpected receipt %d %+v", i, receipt)
+		}
+	}
+}
+
+func TestTransferBatch(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "0")
+	carol := s.createWallet("carol", "0")
+
+	s.ok("transferBatch", alice, fmt.Sprintf("[{\"to\":%q,\"amount\":10},{\"to\":%q,\"amount\":20,\"memo\":\"rent\"}]", bob, carol))
+	s.expectBalance(alice, "70")
+	s.expectBalance(bob, "10")
+	s.expectBalance(carol, "20")
+
+	//A missing recipient aborts the payments before it too
+	nobody := addressOf("nobody")
+	expectMessage(t, s.fails(codeNotFound, "transferBatch", alice, fmt.Sprintf("[{\"to\":%q,\"amount\":10},{\"to\":%q,\"amount\":5}]", bob, nobody)), "Wallet does not exist: "+nobody)
+	expectMessage(t, s.fails(codeInsufficientFunds, "transferBatch", alice, fmt.Sprintf("[{\"to\":%q,\"amount\":50},{\"to\":%q,\"amount\":50}]", bob, carol)), "the batch needs 100")
+	s.fails(codeBadRequest, "transferBatch", alice, fmt.Sprintf("[{\"to\":%q}]", bob))
+	s.expectBalance(alice, "70")
+	s.expectBalance(bob, "10")
+	s.expectBalance(carol, "20")
+}
+
+func TestTransferBatchReceipts(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "0")
+	carol := s.createWallet("carol", "0")
+
+	txID := s.ok("transferBatch", alice, fmt.Sprintf("[{\"to\":%q,\"amount\":10},{\"to\":%q,\"amount\":20,\"memo\":\"rent\"}]", bob, carol)).TxID
+
+	events := []TransferEvent{}
+	s.expectEvent("BatchTransferEvent", &events)
+	expected := []TransferEvent{
+		{From: alice, To: bob, Amount: "10", TxID: txID},
+		{From: alice, To: carol, Amount: "20", Memo: "rent", TxID: txID},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	for i, balance := range []string{"90", "70"} {
+		receipt := TransferReceipt{}
+		decode(t, s.State[s.compositeKey(transferRecordIndex, txID, strconv.Itoa(i))], &receipt)
+		if receipt.TransferEvent != expected[i] || receipt.FromBalance != balance {
+			t.Fatalf("unexpected receipt %d %+v", i, receipt)
+		}
+	}
+}
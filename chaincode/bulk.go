@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+* Define the WalletRequest Structure, it's one of the wallets of a bulk create
+* [Address] <-- Id for the new wallet
+* [Balance] <-- Initial balance, in the configured decimals
+* [Currency] <-- (Optional) Currency the balance is held in, defaults to the base currency
+* [Owner] <-- (Optional) Holder of the wallet, defaults to the caller identity
+ */
+type WalletRequest struct {
+	Address  string      `json:"address"`
+	Balance  json.Number `json:"balance"`
+	Currency string      `json:"currency"`
+	Owner    string      `json:"owner"`
+}
+
+/*
+* createWalletsBulk
+* This method creates many wallets in one transaction, if any of them is malformed or already exists none gets created
+* [wallets]	= This is a JSON Array of {address, balance, currency, owner} objects
+* (JSON)	= JSON Document with the amount of wallets created
+ */
+
+func (t *SimpleChaincode) createWalletsBulk(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("createWalletsBulk", args, 1); err != nil {
+		return errorFromErr(err)
+	}
+
+	requests := []WalletRequest{}
+	err := json.Unmarshal([]byte(args[0]), &requests)
+	if err != nil {
+		return errorJSON(codeBadRequest, "1st Argument must be a JSON Array of wallets: "+err.Error())
+	}
+	if len(requests) == 0 {
+		return errorJSON(codeBadRequest, "The batch has no wallets")
+	}
+
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	callerID, err := getCallerID(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	maxInitialBalance, err := configAmount(config, "maxInitialBalance", config.MaxInitialBalance)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	//Every Wallet is checked before the first one is written, so a bad record never leaves half a batch behind
+	wallets := make([]Wallet, 0, len(requests))
+	seen := make(map[string]bool, len(requests))
+	for i, request := range requests {
+		if request.Address == "" || request.Balance == "" {
+			return errorJSON(codeBadRequest, "wallet "+strconv.Itoa(i)+": address and balance are required")
+		}
+		err = validateAddress(request.Address)
+		if err != nil {
+			return errorJSON(errorCode(err), "wallet "+strconv.Itoa(i)+": "+err.Error())
+		}
+		if seen[request.Address] {
+			return errorJSON(codeConflict, "wallet "+strconv.Itoa(i)+": "+request.Address+" appears twice in the batch")
+		}
+		seen[request.Address] = true
+
+		balance, err := parseAmount(request.Balance.String(), config.Decimals)
+		if err != nil {
+			return errorJSON(codeBadRequest, "wallet "+strconv.Itoa(i)+": balance must be a number: "+err.Error())
+		}
+		if balance.Sign() < 0 {
+			return errorJSON(codeBadRequest, "wallet "+strconv.Itoa(i)+": balance can't be negative")
+		}
+		if maxInitialBalance.Sign() > 0 && balance.Cmp(maxInitialBalance) > 0 {
+			return errorJSON(codeBadRequest, "wallet "+strconv.Itoa(i)+": initial balance exceeds configured cap")
+		}
+
+		existingAsBytes, err := stub.GetState(request.Address)
+		if err != nil {
+			return errorJSON(codeInternal, "Failed to get Wallet: "+err.Error())
+		} else if existingAsBytes != nil {
+			return errorJSON(codeConflict, "wallet already exists: "+request.Address)
+		}
+
+		wallet := Wallet{Address: request.Address, Balance: balance, Held: new(big.Int), Reserved: new(big.Int), SweepThreshold: new(big.Int), Currency: config.BaseCurrency, Owner: callerID}
+		if request.Currency != "" {
+			wallet.Currency = request.Currency
+		}
+		if request.Owner != "" {
+			wallet.Owner = request.Owner
+		}
+		wallet.CreatedAt = timestamp
+		wallet.UpdatedAt = timestamp
+		wallets = append(wallets, wallet)
+	}
+
+	created := new(big.Int)
+	for _, wallet := range wallets {
+		err = storeNewWallet(stub, wallet, "createWalletsBulk")
+		if err != nil {
+			return errorFromErr(err)
+		}
+		created.Add(created, wallet.Balance)
+	}
+
+	//The initial balances are new money in circulation
+	totalSupply, err := readTotalSupply(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = writeTotalSupply(stub, new(big.Int).Add(totalSupply, created))
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = adjustWalletCount(stub, len(wallets))
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Printf(" - END createWalletsBulk (%d created) - \n", len(wallets))
+	return successJSON(stub, []byte("{\"created\":"+strconv.Itoa(len(wallets))+"}"))
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCreateWalletsBulk(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := addressOf("alice")
+	bob := addressOf("bob")
+	carol := addressOf("carol")
+
+	created := struct {
+		Created int `json:"created"`
+	}{}
+	decode(t, s.ok("createWalletsBulk", fmt.Sprintf("[{\"address\":%q,\"balance\":10},{\"address\":%q,\"balance\":20,\"owner\":\"bob\"}]", alice, bob)).Data, &created)
+	if created.Created != 2 || s.wallet(bob).Owner != "bob" {
+		t.Fatalf("unexpected bulk create %+v", created)
+	}
+	s.expectSupply("30")
+
+	//A duplicate, in the batch or on the ledger, aborts the whole batch
+	s.fails(codeConflict, "createWalletsBulk", fmt.Sprintf("[{\"address\":%q,\"balance\":1},{\"address\":%q,\"balance\":1}]", carol, carol))
+	s.fails(codeConflict, "createWalletsBulk", fmt.Sprintf("[{\"address\":%q,\"balance\":1},{\"address\":%q,\"balance\":1}]", carol, alice))
+	s.fails(codeBadRequest, "createWalletsBulk", fmt.Sprintf("[{\"address\":%q,\"balance\":1},{\"address\":%q}]", carol, addressOf("dave")))
+	s.fails(codeNotFound, "queryWallet", carol)
+	s.expectSupply("30")
+	if count := string(s.ok("getWalletCount").Data); count != "2" {
+		t.Fatalf("wallet count is %s", count)
+	}
+}
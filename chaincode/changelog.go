@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+* Define the ChangeLogEntry Structure, one is appended every time a wallet is mutated
+* [TxID] <-- Transaction that mutated the wallet
+* [Op] <-- Name of the operation that mutated the wallet
+* [Delta] <-- Signed change in balance caused by the operation
+* [Timestamp] <-- RFC3339 timestamp of the transaction
+ */
+type ChangeLogEntry struct {
+	TxID      string   `json:"txid"`
+	Op        string   `json:"op"`
+	Delta     *big.Int `json:"delta"`
+	Timestamp string   `json:"timestamp"`
+}
+
+/*
+* MarshalJSON
+* This method saves a change log entry along with the delta it applied
+ */
+
+func (c ChangeLogEntry) MarshalJSON() ([]byte, error) {
+	type storedEntry ChangeLogEntry
+	return json.Marshal(struct {
+		Delta string `json:"delta"`
+		storedEntry
+	}{storedAmount(c.Delta), storedEntry(c)})
+}
+
+/*
+* UnmarshalJSON
+* This method reads a change log entry back from the ledger
+ */
+
+func (c *ChangeLogEntry) UnmarshalJSON(data []byte) error {
+	type storedEntry ChangeLogEntry
+	stored := struct {
+		*storedEntry
+		Delta json.RawMessage `json:"delta"`
+	}{storedEntry: (*storedEntry)(c)}
+	err := json.Unmarshal(data, &stored)
+	if err != nil {
+		return err
+	}
+
+	c.Delta, err = loadStoredAmount("delta", stored.Delta)
+	return err
+}
+
+// Every wallet keeps the log of its balance changes under changelog~<address>
+const changeLogIndex = "changelog"
+
+// Older entries are rotated out once a wallet's log reaches this size to keep the state bounded
+const maxChangeLogEntries = 100
+
+/*
+* getTxTimestamp
+* This method returns the transaction timestamp as an RFC3339 string
+* Since every endorser sees the same timestamp, it keeps the ledger deterministic
+ */
+
+func getTxTimestamp(stub shim.ChaincodeStubInterface) (string, error) {
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return "", err
+	}
+	return txTime.Format(time.RFC3339), nil
+}
+
+/*
+* getTxTime
+* This method returns the time of the transaction, for the functions that compare times instead of storing them
+ */
+
+func getTxTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Failed to get transaction timestamp: %s", err.Error())
+	}
+	return time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC(), nil
+}
+
+/*
+* getChangeLog
+* This method returns the change log of a wallet, oldest entry first
+ */
+
+func getChangeLog(stub shim.ChaincodeStubInterface, address string) ([]ChangeLogEntry, error) {
+	entries := []ChangeLogEntry{}
+	changeLogKey, err := stub.CreateCompositeKey(changeLogIndex, []string{address})
+	if err != nil {
+		return entries, err
+	}
+
+	changeLogAsBytes, err := stub.GetState(changeLogKey)
+	if err != nil {
+		return entries, fmt.Errorf("Failed to get change log: %s", err.Error())
+	} else if changeLogAsBytes == nil {
+		return entries, nil
+	}
+
+	err = json.Unmarshal(changeLogAsBytes, &entries)
+	return entries, err
+}
+
+/*
+* appendChangeLog
+* This method records a mutation on the change log of a wallet
+* [address]	= This is the id for the wallet that was mutated
+* [op]		= This is the name of the operation
+* [delta]	= This is the signed change in balance
+ */
+
+func appendChangeLog(stub shim.ChaincodeStubInterface, address string, op string, delta *big.Int) error {
+	entries, err := getChangeLog(stub, address)
+	if err != nil {
+		return err
+	}
+
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		return err
+	}
+
+	entries = append(entries, ChangeLogEntry{TxID: stub.GetTxID(), Op: op, Delta: delta, Timestamp: timestamp})
+	if len(entries) > maxChangeLogEntries {
+		entries = entries[len(entries)-maxChangeLogEntries:]
+	}
+
+	changeLogKey, err := stub.CreateCompositeKey(changeLogIndex, []string{address})
+	if err != nil {
+		return err
+	}
+
+	changeLogAsBytes, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(changeLogKey, changeLogAsBytes)
+}
+
+/*
+* getWalletChangeLog
+* This method returns a page of the change log of a wallet
+* [id]			= This is the id for the wallet
+* [pageSize]	= (Optional) This is the amount of entries to return, defaults to all of them
+* [offset]		= (Optional) This is the position of the first entry to return
+* (JSON)		= JSON Document with the entries, the total and the offset of the next page
+ */
+
+func (t *SimpleChaincode) getWalletChangeLog(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//		 0			1			2
+	//	  Address	pageSize	  offset
+
+	if err := requireArgsBetween("getWalletChangeLog", args, 1, 3); err != nil {
+		return errorFromErr(err)
+	}
+
+	address := args[0]
+	walletAsBytes, err := stub.GetState(address)
+	if err != nil {
+		return errorJSON(codeInternal, "Failed to get Wallet: "+err.Error())
+	} else if walletAsBytes == nil {
+		return errorJSON(codeNotFound, "Wallet does not exist: "+address)
+	}
+
+	entries, err := getChangeLog(stub, address)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	pageSize := len(entries)
+	if len(args) > 1 {
+		pageSize, err = strconv.Atoi(args[1])
+		if err != nil || pageSize <= 0 {
+			return errorJSON(codeBadRequest, "2nd Argument must be a positive numeric string")
+		}
+	}
+
+	offset := 0
+	if len(args) > 2 {
+		offset, err = strconv.Atoi(args[2])
+		if err != nil || offset < 0 {
+			return errorJSON(codeBadRequest, "3rd Argument must be a non negative numeric string")
+		}
+	}
+
+	//Slice the requested page, an offset past the end is just an empty page
+	start := offset
+	if start > len(entries) {
+		start = len(entries)
+	}
+	end := start + pageSize
+	if end > len(entries) {
+		end = len(entries)
+	}
+
+	response := struct {
+		Entries    []ChangeLogEntry `json:"entries"`
+		Total      int              `json:"total"`
+		NextOffset int              `json:"nextOffset"`
+	}{Entries: entries[start:end], Total: len(entries), NextOffset: end}
+
+	responseAsBytes, err := json.Marshal(response)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Printf("- getWalletChangeLog queryResult:\n%s\n", string(responseAsBytes))
+	return successJSON(stub, responseAsBytes)
+}
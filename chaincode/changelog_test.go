@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestChangeLog(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "0")
+	transfer := s.ok("transferFunds", alice, bob, "30")
+	s.ok("freezeWallet", alice)
+	s.ok("unfreezeWallet", alice)
+	s.ok("mint", alice, "5")
+
+	log := struct {
+		Entries    []ChangeLogEntry `json:"entries"`
+		Total      int              `json:"total"`
+		NextOffset int              `json:"nextOffset"`
+	}{}
+	decode(t, s.ok("getWalletChangeLog", alice).Data, &log)
+	ops := []string{}
+	deltas := []string{}
+	for _, entry := range log.Entries {
+		ops = append(ops, entry.Op)
+		deltas = append(deltas, entry.Delta.String())
+	}
+	expectKeys(t, ops, "initWallet", "transferFunds", "freezeWallet", "unfreezeWallet", "mint")
+	expectKeys(t, deltas, "100", "-30", "0", "0", "5")
+	if log.Entries[1].TxID != transfer.TxID || log.Total != 5 {
+		t.Fatalf("unexpected change log %+v", log)
+	}
+
+	decode(t, s.ok("getWalletChangeLog", alice, "2", "1").Data, &log)
+	if len(log.Entries) != 2 || log.Entries[0].Op != "transferFunds" || log.NextOffset != 3 {
+		t.Fatalf("unexpected page %+v", log)
+	}
+	decode(t, s.ok("getWalletChangeLog", bob).Data, &log)
+	if log.Total != 2 || log.Entries[1].Delta.String() != "30" {
+		t.Fatalf("unexpected change log %+v", log)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// The amount of wallets on the ledger is kept as a single counter
+const walletCountIndex = "walletCount"
+
+/*
+* readWalletCount
+* This method returns the amount of wallets on the ledger, zero when none was ever created
+ */
+
+func readWalletCount(stub shim.ChaincodeStubInterface) (int, error) {
+	walletCountKey, err := stub.CreateCompositeKey(walletCountIndex, []string{})
+	if err != nil {
+		return 0, err
+	}
+
+	walletCountAsBytes, err := stub.GetState(walletCountKey)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to get wallet count: %s", err.Error())
+	} else if walletCountAsBytes == nil {
+		return 0, nil
+	}
+
+	return strconv.Atoi(string(walletCountAsBytes))
+}
+
+/*
+* adjustWalletCount
+* This method adds the created wallets to the count, or takes the deleted ones off it when negative
+* The count never goes below zero, so ledgers that predate it don't end up negative
+ */
+
+func adjustWalletCount(stub shim.ChaincodeStubInterface, delta int) error {
+	walletCount, err := readWalletCount(stub)
+	if err != nil {
+		return err
+	}
+	walletCount += delta
+	if walletCount < 0 {
+		walletCount = 0
+	}
+
+	walletCountKey, err := stub.CreateCompositeKey(walletCountIndex, []string{})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(walletCountKey, []byte(strconv.Itoa(walletCount)))
+}
+
+/*
+* getWalletCount
+* This method returns the amount of wallets from the counter kept by initWallet and deleteWallet
+* (JSON)	= The amount of wallets as a number
+ */
+
+func (t *SimpleChaincode) getWalletCount(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("getWalletCount", args, 0); err != nil {
+		return errorFromErr(err)
+	}
+
+	walletCount, err := readWalletCount(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	return successJSON(stub, []byte(strconv.Itoa(walletCount)))
+}
+
+/*
+* getWalletCountByScan
+* This method returns the amount of wallets by walking every wallet instead of reading the counter
+* It's meant to reconcile the counter, so it's expensive on large ledgers
+* (JSON)	= The amount of wallets as a number
+ */
+
+func (t *SimpleChaincode) getWalletCountByScan(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("getWalletCountByScan", args, 0); err != nil {
+		return errorFromErr(err)
+	}
+
+	_, walletCount, err := sumWalletBalances(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	return successJSON(stub, []byte(strconv.Itoa(walletCount)))
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestWalletCount(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "1")
+	s.createWallet("bob", "2")
+	s.createWallet("carol", "3")
+	s.ok("deleteWallet", alice)
+
+	if count := string(s.ok("getWalletCount").Data); count != "2" {
+		t.Fatalf("getWalletCount returned %s", count)
+	}
+	if count := string(s.ok("getWalletCountByScan").Data); count != "2" {
+		t.Fatalf("getWalletCountByScan returned %s", count)
+	}
+}
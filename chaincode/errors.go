@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Error codes follow their HTTP meaning so clients can tell failures apart
+const (
+	codeBadRequest        = 400
+	codeInsufficientFunds = 402
+	codeForbidden         = 403
+	codeNotFound          = 404
+	codeConflict          = 409
+	codeLocked            = 423
+	codeInternal          = 500
+)
+
+/*
+* Define the ChaincodeError Structure, it's an error that knows which code to report
+* [Code] <-- HTTP-style code of the failure
+* [Message] <-- Human readable description of the failure
+ */
+type ChaincodeError struct {
+	Code    int
+	Message string
+}
+
+func (e *ChaincodeError) Error() string {
+	return e.Message
+}
+
+/*
+* newError
+* This method builds an error that carries its code up to the handler
+ */
+
+func newError(code int, format string, args ...interface{}) error {
+	return &ChaincodeError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+/*
+* errorCode
+* This method returns the code of an error, anything that didn't say otherwise is an internal error
+ */
+
+func errorCode(err error) int {
+	if chaincodeError, ok := err.(*ChaincodeError); ok {
+		return chaincodeError.Code
+	}
+	return codeInternal
+}
+
+/*
+* errorFromErr
+* This method answers a failed invocation with the code and message of an error
+ */
+
+func errorFromErr(err error) pb.Response {
+	return errorJSON(errorCode(err), err.Error())
+}
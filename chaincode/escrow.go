@@ -0,0 +1,388 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Escrows are keyed by the transaction that created them (escrow~<txid>) so they never collide with wallets
+const escrowIndex = "escrow"
+
+// An escrow is open until it's either released to the receiver or refunded to the sender
+const (
+	escrowOpen     = "open"
+	escrowReleased = "released"
+	escrowRefunded = "refunded"
+)
+
+/*
+* Define the Escrow Structure, it's money a sender set aside for a receiver until a condition is met
+* The money stays reserved in the sending wallet, apart from its holds, so it's still counted in the supply
+* [ID] <-- Transaction that created the escrow
+* [From] <-- Wallet the money is reserved in
+* [To] <-- Wallet that receives the money when it's released
+* [Amount] <-- Amount of money in escrow
+* [Memo] <-- Reason for the payment, it becomes the memo of the transfer when it's released
+* [Payer] <-- Identity that created the escrow, the only one that can refund it
+* [Status] <-- Either open, released or refunded
+* [CreatedAt] <-- RFC3339 timestamp of the transaction that created the escrow
+ */
+type Escrow struct {
+	ID        string   `json:"id"`
+	From      string   `json:"from"`
+	To        string   `json:"to"`
+	Amount    *big.Int `json:"amount"`
+	Memo      string   `json:"memo,omitempty"`
+	Payer     string   `json:"payer"`
+	Status    string   `json:"status"`
+	CreatedAt string   `json:"createdAt"`
+}
+
+/*
+* MarshalJSON
+* This method saves an escrow with the amount it holds for the receiver
+ */
+
+func (e Escrow) MarshalJSON() ([]byte, error) {
+	type storedEscrow Escrow
+	return json.Marshal(struct {
+		Amount string `json:"amount"`
+		storedEscrow
+	}{storedAmount(e.Amount), storedEscrow(e)})
+}
+
+/*
+* UnmarshalJSON
+* This method reads an escrow back from the ledger
+ */
+
+func (e *Escrow) UnmarshalJSON(data []byte) error {
+	type storedEscrow Escrow
+	stored := struct {
+		*storedEscrow
+		Amount json.RawMessage `json:"amount"`
+	}{storedEscrow: (*storedEscrow)(e)}
+	err := json.Unmarshal(data, &stored)
+	if err != nil {
+		return err
+	}
+
+	e.Amount, err = loadStoredAmount("amount", stored.Amount)
+	return err
+}
+
+/*
+* createEscrow
+* This method puts money of a wallet in escrow for another wallet, it follows the same rules as a transfer
+* [from]	= This is the id for the wallet paying into the escrow
+* [to]		= This is the id for the wallet the escrow is released to
+* [amount]	= This is the amount of money in escrow
+* [memo]	= (Optional) This is the reason for the payment, required above the memo threshold like a transfer
+* (JSON)	= JSON Document with the id of the escrow
+ */
+
+func (t *SimpleChaincode) createEscrow(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//		 0			1		2		3
+	//		from		to	  amount	  memo
+
+	if err := requireArgsBetween("createEscrow", args, 3, 4); err != nil {
+		return errorFromErr(err)
+	}
+
+	from := args[0]
+	to := args[1]
+	memo := ""
+	if len(args) > 3 {
+		memo = strings.TrimSpace(args[3])
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	amount, err := parseAmount(args[2], config.Decimals)
+	if err != nil {
+		return errorJSON(codeBadRequest, "Failed to parse into Integer, 3rd Argument must be a numeric string: "+err.Error())
+	}
+
+	walletFrom, err := getWallet(stub, from)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	walletTo, err := getWallet(stub, to)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	callerID, err := getCallerID(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = checkTransfer(config, callerID, &walletFrom, &walletTo, amount, memo)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if config.EnforceOwnerAuth && callerID != walletFrom.Owner {
+		return errorJSON(codeForbidden, "caller is not the wallet owner")
+	}
+	if walletFrom.Balance.Cmp(amount) < 0 {
+		return errorJSON(codeInsufficientFunds, "Insufficient funds to create the escrow")
+	}
+
+	//The money moves to the reserved balance of the sender, where neither transfers nor holds can reach it
+	oldBalance := walletFrom.Balance
+	walletFrom.Balance = new(big.Int).Sub(walletFrom.Balance, amount)
+	walletFrom.Reserved = new(big.Int).Add(walletFrom.Reserved, amount)
+	err = saveWallet(stub, oldBalance, walletFrom, "createEscrow")
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	escrow := Escrow{ID: stub.GetTxID(), From: from, To: to, Amount: amount, Memo: memo, Payer: callerID, Status: escrowOpen}
+	escrow.CreatedAt, err = getTxTimestamp(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = putEscrow(stub, escrow)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Println(" - END createEscrow - ")
+	return successJSON(stub, []byte("{\"escrowId\":"+strconv.Quote(escrow.ID)+"}"))
+}
+
+/*
+* releaseEscrow
+* This method pays an open escrow out to its receiver, only the payer or the admin can call it
+* The payout follows the same rules as a transfer and counts against the daily limit of the sender
+* It's exempt from the transfer fee, the escrow only holds what was set aside for the receiver
+* [escrowId]	= This is the id of the escrow
+* (JSON)	= JSON Document with the receipt of the transfer
+ */
+
+func (t *SimpleChaincode) releaseEscrow(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("releaseEscrow", args, 1); err != nil {
+		return errorFromErr(err)
+	}
+
+	escrow, err := loadOpenEscrow(stub, args[0])
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	callerID, err := getCallerID(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	admin := config.Admin != "" && callerID == config.Admin
+	if callerID != escrow.Payer && !admin {
+		return errorJSON(codeForbidden, "Only the payer or the admin can release an escrow")
+	}
+
+	walletFrom, err := getWallet(stub, escrow.From)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	walletTo, err := getWallet(stub, escrow.To)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = checkTransfer(config, callerID, &walletFrom, &walletTo, escrow.Amount, escrow.Memo)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if walletFrom.Reserved.Cmp(escrow.Amount) < 0 {
+		return errorJSON(codeConflict, "wallet "+escrow.From+" no longer reserves the money of escrow "+escrow.ID)
+	}
+	err = spendDailyLimit(stub, escrow.From, escrow.Amount, config.Decimals)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	//The reserved money already left the balance of the sender, so only the receiver's balance moves
+	walletFrom.Reserved = new(big.Int).Sub(walletFrom.Reserved, escrow.Amount)
+	oldBalance := walletTo.Balance
+	walletTo.Balance = new(big.Int).Add(walletTo.Balance, escrow.Amount)
+
+	err = saveWallet(stub, walletFrom.Balance, walletFrom, "releaseEscrow")
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = saveWallet(stub, oldBalance, walletTo, "releaseEscrow")
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	escrow.Status = escrowReleased
+	err = putEscrow(stub, escrow)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	receipt := TransferReceipt{
+		TransferEvent: TransferEvent{From: escrow.From, To: escrow.To, Amount: formatAmount(escrow.Amount, config.Decimals), Memo: escrowMemo(escrow), TxID: stub.GetTxID()},
+		Fee:           formatAmount(new(big.Int), config.Decimals),
+		FromBalance:   formatAmount(walletFrom.Balance, config.Decimals),
+		ToBalance:     formatAmount(walletTo.Balance, config.Decimals),
+	}
+	receiptAsBytes, err := recordTransfer(stub, receipt)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Println(" - END releaseEscrow - ")
+	return successJSON(stub, receiptAsBytes)
+}
+
+/*
+* refundEscrow
+* This method gives the money of an open escrow back to its sender, only the payer can call it
+* [escrowId]	= This is the id of the escrow
+ */
+
+func (t *SimpleChaincode) refundEscrow(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("refundEscrow", args, 1); err != nil {
+		return errorFromErr(err)
+	}
+
+	escrow, err := loadOpenEscrow(stub, args[0])
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	callerID, err := getCallerID(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if callerID != escrow.Payer {
+		return errorJSON(codeForbidden, "Only the payer can refund an escrow")
+	}
+
+	wallet, err := getWallet(stub, escrow.From)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if wallet.Reserved.Cmp(escrow.Amount) < 0 {
+		return errorJSON(codeConflict, "wallet "+escrow.From+" no longer reserves the money of escrow "+escrow.ID)
+	}
+
+	oldBalance := wallet.Balance
+	wallet.Balance = new(big.Int).Add(wallet.Balance, escrow.Amount)
+	wallet.Reserved = new(big.Int).Sub(wallet.Reserved, escrow.Amount)
+	err = saveWallet(stub, oldBalance, wallet, "refundEscrow")
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	escrow.Status = escrowRefunded
+	err = putEscrow(stub, escrow)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Println(" - END refundEscrow - ")
+	return successJSON(stub, nil)
+}
+
+/*
+* escrowMemo
+* This method returns the memo the payout of an escrow is recorded with, the escrow id when the payer gave none
+ */
+
+func escrowMemo(escrow Escrow) string {
+	if escrow.Memo != "" {
+		return escrow.Memo
+	}
+	return "escrow " + escrow.ID
+}
+
+/*
+* getEscrow
+* This method returns an escrow, whatever its status
+* [escrowId]	= This is the id of the escrow
+* (JSON)	= JSON Document with the escrow
+ */
+
+func (t *SimpleChaincode) getEscrow(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("getEscrow", args, 1); err != nil {
+		return errorFromErr(err)
+	}
+
+	escrow, err := getEscrowRecord(stub, args[0])
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	escrowAsBytes, err := json.Marshal(escrow)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	return successJSON(stub, escrowAsBytes)
+}
+
+/*
+* getEscrowRecord
+* This method reads an escrow from the ledger
+ */
+
+func getEscrowRecord(stub shim.ChaincodeStubInterface, id string) (Escrow, error) {
+	escrow := Escrow{}
+	escrowKey, err := stub.CreateCompositeKey(escrowIndex, []string{id})
+	if err != nil {
+		return escrow, err
+	}
+
+	escrowAsBytes, err := stub.GetState(escrowKey)
+	if err != nil {
+		return escrow, fmt.Errorf("Failed to get escrow: %s", err.Error())
+	} else if escrowAsBytes == nil {
+		return escrow, newError(codeNotFound, "Escrow does not exist: %s", id)
+	}
+
+	err = json.Unmarshal(escrowAsBytes, &escrow)
+	return escrow, err
+}
+
+/*
+* loadOpenEscrow
+* This method reads an escrow that can still be released or refunded, so none is ever paid out twice
+ */
+
+func loadOpenEscrow(stub shim.ChaincodeStubInterface, id string) (Escrow, error) {
+	escrow, err := getEscrowRecord(stub, id)
+	if err != nil {
+		return escrow, err
+	}
+	if escrow.Status != escrowOpen {
+		return escrow, newError(codeConflict, "escrow %s was already %s", id, escrow.Status)
+	}
+	return escrow, nil
+}
+
+/*
+* putEscrow
+* This method saves an escrow to the ledger
+ */
+
+func putEscrow(stub shim.ChaincodeStubInterface, escrow Escrow) error {
+	escrowKey, err := stub.CreateCompositeKey(escrowIndex, []string{escrow.ID})
+	if err != nil {
+		return err
+	}
+
+	escrowAsBytes, err := json.Marshal(escrow)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(escrowKey, escrowAsBytes)
+}
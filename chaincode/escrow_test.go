@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEscrow(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "0")
+
+	created := struct {
+		EscrowID string `json:"escrowId"`
+	}{}
+	decode(t, s.as("alice").ok("createEscrow", alice, bob, "30", "deposit").Data, &created)
+	wallet := s.wallet(alice)
+	if wallet.Balance.String() != "70" || wallet.Reserved.String() != "30" || wallet.Held.Sign() != 0 {
+		t.Fatalf("escrow left %s, %s reserved and %s on hold", wallet.Balance, wallet.Reserved, wallet.Held)
+	}
+	s.expectSupply("100")
+
+	//Reserved money is neither spendable nor releasable as a hold
+	s.fails(codeInsufficientFunds, "transferFunds", alice, bob, "71")
+	s.fails(codeInsufficientFunds, "releaseHold", alice, "30")
+	s.fails(codeConflict, "deleteWallet", alice)
+
+	s.as("bob").fails(codeForbidden, "releaseEscrow", created.EscrowID)
+	receipt := TransferReceipt{}
+	decode(t, s.as("alice").ok("releaseEscrow", created.EscrowID).Data, &receipt)
+	if receipt.Memo != "deposit" || receipt.ToBalance != "30" {
+		t.Fatalf("unexpected receipt %+v", receipt)
+	}
+	s.expectBalance(bob, "30")
+	if reserved := s.wallet(alice).Reserved; reserved.Sign() != 0 {
+		t.Fatalf("%s still reserved after the release", reserved)
+	}
+	expectMessage(t, s.as("alice").fails(codeConflict, "releaseEscrow", created.EscrowID), "was already released")
+	s.as("alice").fails(codeConflict, "refundEscrow", created.EscrowID)
+	s.expectBalance(bob, "30")
+
+	decode(t, s.as("alice").ok("createEscrow", alice, bob, "20").Data, &created)
+	expectMessage(t, s.fails(codeForbidden, "refundEscrow", created.EscrowID), "Only the payer can refund an escrow")
+	s.as("alice").ok("refundEscrow", created.EscrowID)
+	s.expectBalance(alice, "70")
+	s.as("alice").fails(codeConflict, "releaseEscrow", created.EscrowID)
+
+	escrow := Escrow{}
+	decode(t, s.ok("getEscrow", created.EscrowID).Data, &escrow)
+	if escrow.Status != escrowRefunded || escrow.Amount.String() != "20" || escrow.Payer != s.idOf("alice") {
+		t.Fatalf("unexpected escrow %+v", escrow)
+	}
+	s.fails(codeNotFound, "getEscrow", "tx9999")
+	s.expectSupply("100")
+}
+
+func TestEscrowReleaseIsFeeExempt(t *testing.T) {
+	treasury := addressOf("treasury")
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY", Treasury: treasury, FeeFlat: "1", FeeBasisPoints: 100})
+	s.createWallet("treasury", "0")
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "0")
+
+	created := struct {
+		EscrowID string `json:"escrowId"`
+	}{}
+	decode(t, s.ok("createEscrow", alice, bob, "50").Data, &created)
+	receipt := TransferReceipt{}
+	decode(t, s.ok("releaseEscrow", created.EscrowID).Data, &receipt)
+	if receipt.Fee != "0" || receipt.FromBalance != "50" {
+		t.Fatalf("unexpected receipt %+v", receipt)
+	}
+	s.expectBalance(alice, "50")
+	s.expectBalance(bob, "50")
+	s.expectBalance(treasury, "0")
+}
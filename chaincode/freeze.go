@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+* freezeWallet
+* This method blocks a wallet from moving any money
+* [id]		= This is the id for the wallet being frozen
+ */
+
+func (t *SimpleChaincode) freezeWallet(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return t.setFrozen(stub, args, true)
+}
+
+/*
+* unfreezeWallet
+* This method lets a frozen wallet move money again
+* [id]		= This is the id for the wallet being unfrozen
+ */
+
+func (t *SimpleChaincode) unfreezeWallet(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return t.setFrozen(stub, args, false)
+}
+
+/*
+* setFrozen
+* This method backs both freezeWallet and unfreezeWallet, only the admin can call it
+* Frozen wallets can't transfer, receive, mint nor burn, and freezing twice is harmless
+* [id]		= This is the id for the wallet being frozen or unfrozen
+ */
+
+func (t *SimpleChaincode) setFrozen(stub shim.ChaincodeStubInterface, args []string, frozen bool) pb.Response {
+	op := "unfreezeWallet"
+	if frozen {
+		op = "freezeWallet"
+	}
+	if err := requireArgs(op, args, 1); err != nil {
+		return errorFromErr(err)
+	}
+
+	admin, err := isAdmin(stub)
+	if err != nil {
+		return errorFromErr(err)
+	} else if !admin {
+		return errorJSON(codeForbidden, "Only the admin can freeze or unfreeze a Wallet")
+	}
+
+	wallet, err := getWallet(stub, args[0])
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	wallet.Frozen = frozen
+	err = putWallet(stub, wallet)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	err = appendChangeLog(stub, wallet.Address, op, new(big.Int))
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Println(" - END " + op + " - ")
+	return successJSON(stub, nil)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFreezeWallet(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "100")
+
+	s.as("bob").fails(codeForbidden, "freezeWallet", alice)
+	s.ok("freezeWallet", alice)
+	expectMessage(t, s.fails(codeLocked, "transferFunds", alice, bob, "10"), "wallet is frozen: "+alice)
+	expectMessage(t, s.fails(codeLocked, "transferFunds", bob, alice, "10"), "wallet is frozen: "+alice)
+	s.fails(codeLocked, "mint", alice, "10")
+
+	s.ok("unfreezeWallet", alice)
+	s.ok("transferFunds", alice, bob, "10")
+	s.expectBalance(alice, "90")
+	s.expectBalance(bob, "110")
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
-	"bytes"
+	"crypto/md5"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"strconv"
+	"strings"
 
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
 )
@@ -24,147 +27,1441 @@ import (
 type SimpleChaincode struct {
 }
 
-/* Define the Wallet Structure with 3 properties
-/ [ID] <-- Wallet Identifier made up of an md5 hash
-/ [Balance] <-- Balance that indicates the amount of money a wallet holds
-/ [Owner] <-- Owner that is the holder of a wallet
-*/
+/*
+* Define the Wallet Structure
+* [ID] <-- Wallet Identifier made up of an md5 hash
+* [Balance] <-- Balance that indicates the amount of money a wallet holds
+* [Held] <-- Money set aside by holds, it's on top of the Balance and can't be spent until released or settled
+* [Reserved] <-- Money the wallet put in open escrows and time locks, it's on top of the Balance and only their payout or refund moves it
+* [Owner] <-- Owner that is the holder of a wallet
+* [KYCVerified] <-- Flag that indicates the owner of a wallet passed KYC
+* [SweepThreshold] <-- Balance above which the excess gets swept to the SweepTarget
+* [SweepTarget] <-- Cold wallet that receives the sweeps, empty means no sweeping
+* [Currency] <-- Currency the balance is held in, empty means the base currency
+* [Frozen] <-- Flag that blocks a wallet from sending or receiving money
+* [CreatedAt] <-- RFC3339 timestamp of the transaction that created the wallet
+* [UpdatedAt] <-- RFC3339 timestamp of the last transaction that saved the wallet
+ */
 type Wallet struct {
+	Address        string   `json:"address"`
+	Balance        *big.Int `json:"balance"`
+	Held           *big.Int `json:"held"`
+	Reserved       *big.Int `json:"reserved"`
+	Owner          string   `json:"owner"`
+	KYCVerified    bool     `json:"kycVerified"`
+	SweepThreshold *big.Int `json:"sweepThreshold"`
+	SweepTarget    string   `json:"sweepTarget"`
+	Currency       string   `json:"currency"`
+	Frozen         bool     `json:"frozen"`
+	CreatedAt      string   `json:"createdAt"`
+	UpdatedAt      string   `json:"updatedAt"`
+}
+
+/*
+* MarshalJSON
+* This method saves the balances and sweep threshold as decimal strings
+* CouchDB compares strings by collation rather than by value, so the balance is also saved as a number,
+* balanceValue, for rich queries to filter on, e.g. {"balanceValue":{"$gt":10000}} in minor units
+ */
+
+func (w Wallet) MarshalJSON() ([]byte, error) {
+	type storedWallet Wallet
+	return json.Marshal(struct {
+		Address        string      `json:"address"`
+		Balance        string      `json:"balance"`
+		BalanceValue   json.Number `json:"balanceValue"`
+		Held           string      `json:"held"`
+		Reserved       string      `json:"reserved"`
+		SweepThreshold string      `json:"sweepThreshold"`
+		storedWallet
+	}{w.Address, storedAmount(w.Balance), json.Number(storedAmount(w.Balance)), storedAmount(w.Held), storedAmount(w.Reserved), storedAmount(w.SweepThreshold), storedWallet(w)})
+}
+
+/*
+* UnmarshalJSON
+* This method reads the balances either as decimal strings or as the plain numbers Wallets were saved with before
+ */
+
+func (w *Wallet) UnmarshalJSON(data []byte) error {
+	type storedWallet Wallet
+	stored := struct {
+		*storedWallet
+		Balance        json.RawMessage `json:"balance"`
+		Held           json.RawMessage `json:"held"`
+		Reserved       json.RawMessage `json:"reserved"`
+		SweepThreshold json.RawMessage `json:"sweepThreshold"`
+	}{storedWallet: (*storedWallet)(w)}
+	err := json.Unmarshal(data, &stored)
+	if err != nil {
+		return err
+	}
+
+	w.Balance, err = loadStoredAmount("balance", stored.Balance)
+	if err != nil {
+		return err
+	}
+	w.Held, err = loadStoredAmount("held", stored.Held)
+	if err != nil {
+		return err
+	}
+	w.Reserved, err = loadStoredAmount("reserved", stored.Reserved)
+	if err != nil {
+		return err
+	}
+	w.SweepThreshold, err = loadStoredAmount("sweepThreshold", stored.SweepThreshold)
+	return err
+}
+
+/*
+* storedAmount
+* This method writes an amount the way every record on the ledger stores it, a missing amount is zero
+* Amounts are saved as decimal strings of minor units, so clients that read numbers as doubles don't lose precision
+ */
+
+func storedAmount(amount *big.Int) string {
+	if amount == nil {
+		return "0"
+	}
+	return amount.String()
+}
+
+/*
+* loadStoredAmount
+* This method reads an amount a record stored, as a decimal string, as the plain number older records were saved with or not at all
+ */
+
+func loadStoredAmount(name string, raw json.RawMessage) (*big.Int, error) {
+	value := strings.Trim(string(raw), "\"")
+	if value == "" || value == "null" {
+		return new(big.Int), nil
+	}
+	amount, ok := new(big.Int).SetString(value, 10)
+	if !ok {
+		return nil, fmt.Errorf("%s %s is not a whole number", name, value)
+	}
+	return amount, nil
+}
+
+/*
+* Define the Config Structure, it holds the policies set when 'Halley' is instantiated
+* [Admin] <-- Identity allowed to call the administrative functions
+* [RequireKYCForReceive] <-- Rejects transfers to wallets that aren't KYC-verified
+* [BaseCurrency] <-- Currency every balance gets valued in for reporting
+* [ReasonRequiredThreshold] <-- Transfers above this amount need a memo, empty or zero means never
+* [Issuer] <-- Identity allowed to mint new funds, defaults to the admin
+* [EnforceOwnerAuth] <-- Only lets the owner of a wallet move money out of it
+* [Treasury] <-- Wallet that collects the transfer fees, empty means no fees are charged
+* [FeeFlat] <-- Flat fee charged on every transfer, empty means none
+* [FeeBasisPoints] <-- Fee charged on every transfer in hundredths of a percent of the amount
+* [MaxInitialBalance] <-- Highest balance a wallet can be created with, empty or zero means no cap
+* [Decimals] <-- Decimal places amounts are given in, balances are stored as whole minor units
+* The threshold, flat fee and cap are decimal strings in those decimals, e.g. "0.50", like every other amount clients send
+* [Name] <-- Name of the token the wallets hold, e.g. Halley Coin
+* [Symbol] <-- Ticker of the token, e.g. HLY
+ */
+type Config struct {
+	Admin                   string `json:"admin"`
+	RequireKYCForReceive    bool   `json:"requireKYCForReceive"`
+	BaseCurrency            string `json:"baseCurrency"`
+	ReasonRequiredThreshold string `json:"reasonRequiredThreshold"`
+	Issuer                  string `json:"issuer"`
+	EnforceOwnerAuth        bool   `json:"enforceOwnerAuth"`
+	Treasury                string `json:"treasury"`
+	FeeFlat                 string `json:"feeFlat"`
+	FeeBasisPoints          int    `json:"feeBasisPoints"`
+	MaxInitialBalance       string `json:"maxInitialBalance"`
+	Decimals                int    `json:"decimals"`
+	Name                    string `json:"name"`
+	Symbol                  string `json:"symbol"`
+}
+
+// Every record that isn't a Wallet lives under a composite key, which starts with U+0000,
+// so none of them ever shows up on wallet range queries
+
+// The config is a single record shared by every transaction
+const configIndex = "config"
+
+// Every wallet is indexed by its address and balance to look faster for Wallets
+const addressBalanceIndex = "address~balance"
+
+// Every wallet is indexed by its owner so the wallets of an owner can be listed
+const ownerIDIndex = "owner~id"
+
+// Create requests that carry a client id leave a marker under it so retries can be recognized
+const requestIndex = "req"
+
+// Wallet addresses are md5 hashes written as lowercase hex
+const addressLength = 32
+
+// Memos are kept on every transfer receipt, so they're capped to keep the state small
+const maxMemoLength = 256
+
+/*
+* The main method is only relevant in unit test mode.
+* Included here for completeness
+ */
+func main() {
+	err := shim.Start(new(SimpleChaincode))
+	if err != nil {
+		fmt.Printf("Error starting Transaction Chaincode implementation: %s", err)
+	}
+}
+
+/*
+*The Init method is called when the Smart Contract 'Halley' is instantiated by the blockchain network
+* Best practice is to have any Ledger initialization as a separate function
+* Init also runs on every upgrade: without a config the stored one is kept as is,
+* with one only the admin can replace it, and the decimals can't change once wallets exist
+ */
+
+func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	//		   0
+	//	[Config JSON]
+	_, args := stub.GetFunctionAndParameters()
+
+	//The admin is set on the first instantiation, so a stored admin means this is an upgrade
+	stored, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	upgrade := stored.Admin != ""
+
+	config := Config{}
+	if len(args) > 0 && len(args[0]) > 0 {
+		err := json.Unmarshal([]byte(args[0]), &config)
+		if err != nil {
+			return errorJSON(codeBadRequest, "Config must be a JSON document: "+err.Error())
+		}
+	} else if upgrade {
+		return successJSON(stub, nil)
+	}
+
+	if upgrade {
+		callerID, err := getCallerID(stub)
+		if err != nil {
+			return errorFromErr(err)
+		}
+		if callerID != stored.Admin {
+			return errorJSON(codeForbidden, "Only the admin can change the config on an upgrade")
+		}
+
+		//Balances are stored in minor units, so other decimals would silently rescale every one of them
+		if config.Decimals != stored.Decimals {
+			walletCount, err := readWalletCount(stub)
+			if err != nil {
+				return errorFromErr(err)
+			}
+			if walletCount > 0 {
+				return errorJSON(codeConflict, "decimals can't change once wallets exist")
+			}
+		}
+	}
+
+	if config.Decimals < 0 || config.Decimals > maxDecimals {
+		return errorJSON(codeBadRequest, fmt.Sprintf("decimals must be between 0 and %d", maxDecimals))
+	}
+	if config.FeeBasisPoints < 0 || config.FeeBasisPoints > 10000 {
+		return errorJSON(codeBadRequest, "Fees must be non negative and feeBasisPoints can't exceed 10000")
+	}
+	for name, value := range map[string]string{"feeFlat": config.FeeFlat, "maxInitialBalance": config.MaxInitialBalance, "reasonRequiredThreshold": config.ReasonRequiredThreshold} {
+		if _, err := configAmount(config, name, value); err != nil {
+			return errorFromErr(err)
+		}
+	}
+
+	//An upgrade that doesn't restate the token keeps the one it was instantiated with
+	if config.Name == "" && config.Symbol == "" {
+		config.Name = stored.Name
+		config.Symbol = stored.Symbol
+	}
+	if config.Name == "" || config.Symbol == "" {
+		return errorJSON(codeBadRequest, "Config must set the name and symbol of the token")
+	}
+
+	//Whoever instantiates the Smart Contract becomes the admin unless one is given
+	if config.Admin == "" {
+		callerID, err := getCallerID(stub)
+		if err != nil {
+			return errorFromErr(err)
+		}
+		config.Admin = callerID
+	}
+	if config.Issuer == "" {
+		config.Issuer = config.Admin
+	}
+
+	err = putConfig(stub, config)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	return successJSON(stub, nil)
+}
+
+/*
+* getCallerID
+* This method returns the unique identity of the client that submitted the transaction
+ */
+
+func getCallerID(stub shim.ChaincodeStubInterface) (string, error) {
+	callerID, err := cid.GetID(stub)
+	if err != nil {
+		return "", fmt.Errorf("Failed to get caller identity: %s", err.Error())
+	}
+	return callerID, nil
+}
+
+/*
+* getConfig
+* This method returns the Config saved when the Smart Contract was instantiated
+ */
+
+func getConfig(stub shim.ChaincodeStubInterface) (Config, error) {
+	config := Config{}
+	configKey, err := stub.CreateCompositeKey(configIndex, []string{})
+	if err != nil {
+		return config, err
+	}
+
+	configAsBytes, err := stub.GetState(configKey)
+	if err != nil {
+		return config, fmt.Errorf("Failed to get config: %s", err.Error())
+	} else if configAsBytes == nil {
+		return config, nil
+	}
+
+	err = json.Unmarshal(configAsBytes, &config)
+	return config, err
+}
+
+/*
+* putConfig
+* This method saves the Config to the ledger
+ */
+
+func putConfig(stub shim.ChaincodeStubInterface, config Config) error {
+	configKey, err := stub.CreateCompositeKey(configIndex, []string{})
+	if err != nil {
+		return err
+	}
+
+	configAsBytes, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(configKey, configAsBytes)
+}
+
+/*
+* validateAddress
+* This method checks an address is an md5 hash, so it can be used as a wallet id and inside composite keys
+* Every reserved record lives under a composite key, which starts with U+0000, so no md5 hash can ever collide with one
+* [address]	= This is the id being validated
+ */
+
+func validateAddress(address string) error {
+	if len(address) != addressLength {
+		return newError(codeBadRequest, "address must be an md5 hash of %d characters, got %d", addressLength, len(address))
+	}
+	for i, r := range address {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return newError(codeBadRequest, "address must be an md5 hash in lowercase hex, got %q at position %d", r, i)
+		}
+	}
+	return nil
+}
+
+/*
+* getWallet
+* This method loads a wallet from the ledger
+ */
+
+func getWallet(stub shim.ChaincodeStubInterface, address string) (Wallet, error) {
+	wallet := Wallet{}
+	walletAsBytes, err := stub.GetState(address)
+	if err != nil {
+		return wallet, fmt.Errorf("Failed to get Wallet: %s", err.Error())
+	} else if walletAsBytes == nil {
+		return wallet, newError(codeNotFound, "Wallet does not exist: %s", address)
+	}
+
+	return unmarshalWallet(address, walletAsBytes)
+}
+
+/*
+* unmarshalWallet
+* This method reads the stored bytes of a wallet, saying which wallet is corrupt when they can't be read
+ */
+
+func unmarshalWallet(address string, walletAsBytes []byte) (Wallet, error) {
+	wallet := Wallet{}
+	err := json.Unmarshal(walletAsBytes, &wallet)
+	if err != nil {
+		return Wallet{}, newError(codeInternal, "wallet %s state is corrupt: %s", address, err.Error())
+	}
+	return wallet, nil
+}
+
+/*
+* putWallet
+* This method saves a wallet to the ledger, stamping it with the time of the transaction
+ */
+
+func putWallet(stub shim.ChaincodeStubInterface, wallet Wallet) error {
+	var err error
+	wallet.UpdatedAt, err = getTxTimestamp(stub)
+	if err != nil {
+		return err
+	}
+
+	walletAsBytes, err := json.Marshal(wallet)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(wallet.Address, walletAsBytes)
+}
+
+/*
+* getAddressBalanceIndexKey
+* This method builds the address~balance index key of a wallet
+ */
+
+func getAddressBalanceIndexKey(stub shim.ChaincodeStubInterface, address string, balance *big.Int) (string, error) {
+	return stub.CreateCompositeKey(addressBalanceIndex, []string{address, balance.String()})
+}
+
+/*
+* reindexWallet
+* This method moves the address~balance index entry of a wallet after its balance changed
+ */
+
+func reindexWallet(stub shim.ChaincodeStubInterface, oldBalance *big.Int, wallet Wallet) error {
+	if oldBalance.Cmp(wallet.Balance) == 0 {
+		return nil
+	}
+
+	oldIndexKey, err := getAddressBalanceIndexKey(stub, wallet.Address, oldBalance)
+	if err != nil {
+		return err
+	}
+	err = stub.DelState(oldIndexKey)
+	if err != nil {
+		return fmt.Errorf("Failed to delete Wallet index: %s", err.Error())
+	}
+
+	newIndexKey, err := getAddressBalanceIndexKey(stub, wallet.Address, wallet.Balance)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(newIndexKey, []byte{0x00})
+}
+
+/*
+* indexOwner
+* This method adds the owner~id index entry of a wallet
+ */
+
+func indexOwner(stub shim.ChaincodeStubInterface, owner string, address string) error {
+	ownerIDIndexKey, err := stub.CreateCompositeKey(ownerIDIndex, []string{owner, address})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(ownerIDIndexKey, []byte{0x00})
+}
+
+/*
+* unindexOwner
+* This method removes the owner~id index entry of a wallet
+ */
+
+func unindexOwner(stub shim.ChaincodeStubInterface, owner string, address string) error {
+	ownerIDIndexKey, err := stub.CreateCompositeKey(ownerIDIndex, []string{owner, address})
+	if err != nil {
+		return err
+	}
+	return stub.DelState(ownerIDIndexKey)
+}
+
+/*
+* isAdmin
+* This method checks if the caller is the admin recorded in the Config
+ */
+
+func isAdmin(stub shim.ChaincodeStubInterface) (bool, error) {
+	config, err := getConfig(stub)
+	if err != nil {
+		return false, err
+	}
+
+	callerID, err := getCallerID(stub)
+	if err != nil {
+		return false, err
+	}
+	return config.Admin != "" && callerID == config.Admin, nil
+}
+
+/*
+* handlers
+* This method registers every function the Invoke method is able to route to
+* (map)	= Map from the function name to the handler that serves it
+ */
+
+func (t *SimpleChaincode) handlers() map[string]func(shim.ChaincodeStubInterface, []string) pb.Response {
+	return map[string]func(shim.ChaincodeStubInterface, []string) pb.Response{
+		//createWallet and queryWallet are kept as aliases for clients of the older chaincode
+		"initWallet":                      t.initWallet,
+		"createWalletsBulk":               t.createWalletsBulk,
+		"createWalletAuto":                t.createWalletAuto,
+		"createWallet":                    t.initWallet,
+		"transferFunds":                   t.transferFunds,
+		"transferFundsWithMemo":           t.transferFundsWithMemo,
+		"transferPercent":                 t.transferPercent,
+		"transferFundsIdempotent":         t.transferFundsIdempotent,
+		"readWallet":                      t.readWallet,
+		"queryWallet":                     t.readWallet,
+		"queryWalletRaw":                  t.queryWalletRaw,
+		"getWallets":                      t.getWallets,
+		"getWalletsBatch":                 t.getWalletsBatch,
+		"getWalletsByRange":               t.getWalletsByRange,
+		"setKYCStatus":                    t.setKYCStatus,
+		"getWalletChangeLog":              t.getWalletChangeLog,
+		"setSweepConfig":                  t.setSweepConfig,
+		"setDailyLimit":                   t.setDailyLimit,
+		"runSweeps":                       t.runSweeps,
+		"setExchangeRate":                 t.setExchangeRate,
+		"getWalletValueAsOf":              t.getWalletValueAsOf,
+		"getWalletHistory":                t.getWalletHistory,
+		"getWalletsByRangeWithPagination": t.getWalletsByRangeWithPagination,
+		"queryWalletsBySelector":          t.queryWalletsBySelector,
+		"queryWalletsWithPagination":      t.queryWalletsWithPagination,
+		"deleteWallet":                    t.deleteWallet,
+		"closeWallet":                     t.closeWallet,
+		"adminTransfer":                   t.adminTransfer,
+		"deleteAllWallets":                t.deleteAllWallets,
+		"mint":                            t.mint,
+		"mintFunds":                       t.mint,
+		"burn":                            t.burn,
+		"burnFunds":                       t.burn,
+		"getBalance":                      t.getBalance,
+		"freezeWallet":                    t.freezeWallet,
+		"unfreezeWallet":                  t.unfreezeWallet,
+		"batchTransfer":                   t.batchTransfer,
+		"getTotalSupply":                  t.getTotalSupply,
+		"getTotalSupplyByScan":            t.getTotalSupplyByScan,
+		"auditSupply":                     t.auditSupply,
+		"getWalletCount":                  t.getWalletCount,
+		"getWalletCountByScan":            t.getWalletCountByScan,
+		"updateOwner":                     t.updateOwner,
+		"getWalletsByBalanceRange":        t.getWalletsByBalanceRange,
+		"getTopWallets":                   t.getTopWallets,
+		"queryWalletsByOwner":             t.queryWalletsByOwner,
+		"getOwnerSummary":                 t.getOwnerSummary,
+		"transferBatch":                   t.transferBatch,
+		"approve":                         t.approve,
+		"allowance":                       t.allowance,
+		"increaseAllowance":               t.increaseAllowance,
+		"decreaseAllowance":               t.decreaseAllowance,
+		"transferFrom":                    t.transferFrom,
+		"getReceipt":                      t.getReceipt,
+		"getTransaction":                  t.getReceipt,
+		"getTransactionsByRange":          t.getTransactionsByRange,
+		"placeHold":                       t.placeHold,
+		"releaseHold":                     t.releaseHold,
+		"settleHold":                      t.settleHold,
+		"holdFunds":                       t.placeHold,
+		"releaseFunds":                    t.releaseFunds,
+		"createEscrow":                    t.createEscrow,
+		"releaseEscrow":                   t.releaseEscrow,
+		"refundEscrow":                    t.refundEscrow,
+		"getEscrow":                       t.getEscrow,
+		"createTimeLock":                  t.createTimeLock,
+		"claimTimeLock":                   t.claimTimeLock,
+		"pause":                           t.pause,
+		"unpause":                         t.unpause,
+		"getInfo":                         t.getInfo,
+		"getTokenInfo":                    t.getTokenInfo,
+		"transferAdmin":                   t.transferAdmin,
+	}
+}
+
+/*
+* The Invoke method is called as a result of an application request to the Smart Contract 'Halley'
+* The calling application program has also specified the particular smart contract function to be called, with arguments
+ */
+
+func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	// Retrieve the requested Smart Contract function and arguments
+	function, args := stub.GetFunctionAndParameters()
+	fmt.Println("Invoke is running: " + function)
+	//Route to the appropiate handler function to interact with the ledger appropiately
+	if handler, ok := t.handlers()[function]; ok {
+		//While paused, only queries get through
+		if err := requireNotPaused(stub, function); err != nil {
+			return errorFromErr(err)
+		}
+		return handler(stub, args)
+	}
+
+	// If nothing was invoked, launch an error
+	fmt.Println("Invoke didn't find function: " + function)
+	return errorJSON(codeBadRequest, "Received Unknown function invocation")
+}
+
+/*
+* initWallet
+* This method creates a wallet and initializes it into the system
+* [id]		= This is a number that identifies the wallet
+* [balance]	= This is the numerical balance of the account
+* [currency]	= (Optional) This is the currency the balance is held in, defaults to the base currency
+* [owner]	= (Optional) This is the holder of the wallet, defaults to the caller identity when empty
+* [requestId]	= (Optional) This is an id chosen by the client, replaying it answers the original success
+* (JSON)	= JSON Document with the id of the created wallet
+ */
+
+func (t *SimpleChaincode) initWallet(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	// 	  0			  1				2		  3		  4
+	// Address	Initial Balance	 Currency	Owner	RequestId
+
+	if err := requireArgsBetween("initWallet", args, 2, 5); err != nil {
+		return errorFromErr(err)
+	}
+
+	//Input Sanitation as this part is really important
+	fmt.Printf(" - Initializing Wallet - ")
+
+	if err := requireNonEmpty(args[:2]...); err != nil {
+		return errorFromErr(err)
+	}
+
+	//Variable initialization
+	address := args[0]
+	err = validateAddress(address)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	balance, err := parseAmount(args[1], config.Decimals)
+	if err != nil {
+		return errorJSON(codeBadRequest, "2nd Argument must be a numeric string: "+err.Error())
+	}
+	if balance.Sign() < 0 {
+		return errorJSON(codeBadRequest, "2nd Argument can't be negative")
+	}
+
+	//A cap guards against wallets created with an absurd starting balance by mistake
+	maxInitialBalance, err := configAmount(config, "maxInitialBalance", config.MaxInitialBalance)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if maxInitialBalance.Sign() > 0 && balance.Cmp(maxInitialBalance) > 0 {
+		return errorJSON(codeBadRequest, "initial balance exceeds configured cap")
+	}
+
+	//A retried request finds its marker and gets the original answer instead of a conflict
+	requestKey := ""
+	if len(args) > 4 && args[4] != "" {
+		requestKey, err = stub.CreateCompositeKey(requestIndex, []string{args[4]})
+		if err != nil {
+			return errorFromErr(err)
+		}
+		requestAsBytes, err := stub.GetState(requestKey)
+		if err != nil {
+			return errorJSON(codeInternal, "Failed to get request: "+err.Error())
+		} else if requestAsBytes != nil {
+			if string(requestAsBytes) != address {
+				return errorJSON(codeConflict, "request id "+args[4]+" was already used for wallet "+string(requestAsBytes))
+			}
+			fmt.Println(" - END Wallet Init (replayed) - ")
+			return successJSON(stub, []byte("{\"address\":"+strconv.Quote(address)+"}"))
+		}
+	}
+
+	//An existing Wallet must never be reset
+	existingAsBytes, err := stub.GetState(address)
+	if err != nil {
+		return errorJSON(codeInternal, "Failed to get Wallet: "+err.Error())
+	} else if existingAsBytes != nil {
+		return errorJSON(codeConflict, "wallet already exists: "+address)
+	}
+
+	//Create the Wallet object and convert it to bytes to save
+	Wallet := Wallet{Address: address, Balance: balance, Held: new(big.Int), Reserved: new(big.Int), SweepThreshold: new(big.Int)}
+	//Every new Wallet carries its currency, so it keeps it even if the base currency changes
+	Wallet.Currency = config.BaseCurrency
+	if len(args) > 2 && args[2] != "" {
+		Wallet.Currency = args[2]
+	}
+	//Unless told otherwise, whoever creates the Wallet owns it
+	if len(args) > 3 && args[3] != "" {
+		Wallet.Owner = args[3]
+	} else {
+		Wallet.Owner, err = getCallerID(stub)
+		if err != nil {
+			return errorFromErr(err)
+		}
+	}
+	Wallet.CreatedAt, err = getTxTimestamp(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	Wallet.UpdatedAt = Wallet.CreatedAt
+	err = storeNewWallet(stub, Wallet, "initWallet")
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	//The initial balance is new money in circulation
+	totalSupply, err := readTotalSupply(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = writeTotalSupply(stub, new(big.Int).Add(totalSupply, balance))
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = adjustWalletCount(stub, 1)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if requestKey != "" {
+		err = stub.PutState(requestKey, []byte(address))
+		if err != nil {
+			return errorFromErr(err)
+		}
+	}
+
+	//Wallet saved and indexed, return the id along with the txid that created it
+	fmt.Println(" - END Wallet Init - ")
+	return successJSON(stub, []byte("{\"address\":"+strconv.Quote(address)+"}"))
+}
+
+/*
+* createWalletAuto
+* This method creates a wallet whose id is derived from its owner and the transaction, so clients don't pick ids
+* The id is the md5 hash of the owner and the txid, every endorser derives the same one
+* [owner]	= This is the holder of the wallet, defaults to the caller identity when empty
+* [balance]	= This is the numerical balance of the account
+* [currency]	= (Optional) This is the currency the balance is held in, defaults to the base currency
+* (JSON)	= JSON Document with the id of the created wallet
+ */
+
+func (t *SimpleChaincode) createWalletAuto(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//	  0			  1				2
+	//	Owner	Initial Balance	 Currency
+
+	if err := requireArgsBetween("createWalletAuto", args, 2, 3); err != nil {
+		return errorFromErr(err)
+	}
+
+	owner := args[0]
+	if owner == "" {
+		callerID, err := getCallerID(stub)
+		if err != nil {
+			return errorFromErr(err)
+		}
+		owner = callerID
+	}
+	currency := ""
+	if len(args) > 2 {
+		currency = args[2]
+	}
+
+	//The separator keeps an owner ending in hex digits from running into the txid
+	address := fmt.Sprintf("%x", md5.Sum([]byte(owner+"\x00"+stub.GetTxID())))
+	return t.initWallet(stub, []string{address, args[1], currency, owner})
+}
+
+/*
+* storeNewWallet
+* This method saves a freshly created wallet along with its index entries and the start of its change log
+* Supply and wallet count are left to the caller, so batches can adjust them once
+ */
+
+func storeNewWallet(stub shim.ChaincodeStubInterface, wallet Wallet, op string) error {
+	walletAsBytes, err := json.Marshal(wallet)
+	if err != nil {
+		return err
+	}
+
+	//Save the Wallet to the blockchain
+	err = stub.PutState(wallet.Address, walletAsBytes)
+	if err != nil {
+		return err
+	}
+
+	//Create an Index to look faster for Wallets
+	addressBalanceIndexKey, err := getAddressBalanceIndexKey(stub, wallet.Address, wallet.Balance)
+	if err != nil {
+		return err
+	}
+
+	//Save Index to State
+	value := []byte{0x00}
+	err = stub.PutState(addressBalanceIndexKey, value)
+	if err != nil {
+		return err
+	}
+
+	err = indexOwner(stub, wallet.Owner, wallet.Address)
+	if err != nil {
+		return err
+	}
+
+	//Start the change log of the Wallet
+	return appendChangeLog(stub, wallet.Address, op, wallet.Balance)
+}
+
+/*
+* readWallet
+* This method returns the current state of a wallet on the ledger
+* [id]		= This is an md5 hash that identifies the wallet
+* (JSON)	= JSON Document with the current state of the wallet
+ */
+
+func (t *SimpleChaincode) readWallet(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var address string
+	var err error
+
+	if err := requireArgs("readWallet", args, 1); err != nil {
+		return errorFromErr(err)
+	}
+
+	address = args[0]
+	valAsBytes, err := stub.GetState(address)
+	if err != nil {
+		return errorJSON(codeInternal, "Failed to get state for "+address)
+	} else if valAsBytes == nil {
+		return errorJSON(codeNotFound, "Wallet does not exist: "+address)
+	}
+	//Corrupt state is reported as such instead of being handed back
+	_, err = unmarshalWallet(address, valAsBytes)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	return successJSON(stub, valAsBytes)
+}
+
+/*
+* queryWalletRaw
+* This method returns the stored wallet as the whole payload, without the Response around it
+* It's meant for clients that unmarshal the payload straight into a Wallet, errors still come as a Response
+* [id]		= This is the id for the wallet
+* (JSON)	= JSON Document with the current state of the wallet
+ */
+
+func (t *SimpleChaincode) queryWalletRaw(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("queryWalletRaw", args, 1); err != nil {
+		return errorFromErr(err)
+	}
+
+	wallet, err := getWallet(stub, args[0])
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	walletAsBytes, err := json.Marshal(wallet)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	return shim.Success(walletAsBytes)
+}
+
+/*
+* getBalance
+* This method returns only the balance of a wallet
+* [id]		= This is the id for the wallet
+* (JSON)	= JSON Document with just the balance and the money on hold, in the configured decimals
+ */
+
+func (t *SimpleChaincode) getBalance(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("getBalance", args, 1); err != nil {
+		return errorFromErr(err)
+	}
+
+	wallet, err := getWallet(stub, args[0])
+	if err != nil {
+		return errorFromErr(err)
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	//The balances are written as decimal strings in the configured decimals, e.g. "10.50"
+	balanceAsBytes, err := json.Marshal(struct {
+		Balance  string `json:"balance"`
+		Held     string `json:"held"`
+		Reserved string `json:"reserved"`
+	}{formatAmount(wallet.Balance, config.Decimals), formatAmount(wallet.Held, config.Decimals), formatAmount(wallet.Reserved, config.Decimals)})
+	if err != nil {
+		return errorFromErr(err)
+	}
+	return successJSON(stub, balanceAsBytes)
+}
+
+/*
+* deleteWallet
+* This method removes a wallet and its index entry from the ledger, only the admin can call it
+* [id]		= This is the id for the wallet being deleted
+ */
+
+func (t *SimpleChaincode) deleteWallet(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("deleteWallet", args, 1); err != nil {
+		return errorFromErr(err)
+	}
+
+	admin, err := isAdmin(stub)
+	if err != nil {
+		return errorFromErr(err)
+	} else if !admin {
+		return errorJSON(codeForbidden, "Only the admin can delete a Wallet")
+	}
+
+	//The stored balance is needed to rebuild the index key, so the Wallet has to be read first
+	address := args[0]
+	wallet, err := getWallet(stub, address)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	//Money in open escrows and time locks has to be paid out first, or they'd be left with nothing to pay
+	if wallet.Reserved.Sign() != 0 {
+		config, err := getConfig(stub)
+		if err != nil {
+			return errorFromErr(err)
+		}
+		return errorJSON(codeConflict, "wallet "+address+" still has "+formatAmount(wallet.Reserved, config.Decimals)+" reserved by open escrows or time locks")
+	}
+
+	err = removeWallet(stub, wallet)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	//Whatever the Wallet held leaves circulation with it, money on hold included
+	err = reduceTotalSupply(stub, new(big.Int).Add(wallet.Balance, wallet.Held))
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = adjustWalletCount(stub, -1)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Println(" - END deleteWallet - ")
+	return successJSON(stub, nil)
+}
+
+/*
+* Define the WalletClosedEvent Structure, it's emitted when a wallet is closed
+* [Address] <-- Wallet that was closed
+* [TxID] <-- Transaction that closed it
+ */
+type WalletClosedEvent struct {
 	Address string `json:"address"`
-	Balance int    `json:"balance"`
+	TxID    string `json:"txId"`
+}
+
+/*
+* closeWallet
+* This method removes an empty wallet and its index entries from the ledger, so no money is ever destroyed
+* Closing follows the same owner rule as a transfer, the admin can always close one
+* [id]		= This is the id for the wallet being closed
+ */
+
+func (t *SimpleChaincode) closeWallet(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("closeWallet", args, 1); err != nil {
+		return errorFromErr(err)
+	}
+
+	address := args[0]
+	wallet, err := getWallet(stub, address)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if wallet.Frozen {
+		return errorJSON(codeLocked, "wallet is frozen: "+address)
+	}
+
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	callerID, err := getCallerID(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	admin := config.Admin != "" && callerID == config.Admin
+	if config.EnforceOwnerAuth && callerID != wallet.Owner && !admin {
+		return errorJSON(codeForbidden, "caller is not the wallet owner")
+	}
+
+	//Money on hold still belongs to the Wallet, so it has to be released or settled first
+	if wallet.Balance.Sign() != 0 || wallet.Held.Sign() != 0 {
+		return errorJSON(codeConflict, "wallet "+address+" still holds "+formatAmount(wallet.Balance, config.Decimals)+" and "+formatAmount(wallet.Held, config.Decimals)+" on hold")
+	}
+	if wallet.Reserved.Sign() != 0 {
+		return errorJSON(codeConflict, "wallet "+address+" still has "+formatAmount(wallet.Reserved, config.Decimals)+" reserved by open escrows or time locks")
+	}
+
+	err = removeWallet(stub, wallet)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = adjustWalletCount(stub, -1)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	eventAsBytes, err := json.Marshal(WalletClosedEvent{Address: address, TxID: stub.GetTxID()})
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = stub.SetEvent("WalletClosedEvent", eventAsBytes)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Println(" - END closeWallet - ")
+	return successJSON(stub, nil)
+}
+
+/*
+* adminTransfer
+* This method moves the whole balance of a wallet into another one, only the admin can call it
+* It's meant to retire wallets, so it charges no fee and skips the owner and KYC rules
+* [from]	= This is the id for the wallet being emptied
+* [to]		= This is the id for the wallet receiving its balance, e.g. the treasury
+* [delete]	= (Optional) This is "true" to delete the emptied wallet, it defaults to "false"
+* (JSON)	= JSON Document with the receipt of the transfer
+ */
+
+func (t *SimpleChaincode) adminTransfer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//		 0			1		2
+	//		from		to	  delete
+
+	if err := requireArgsBetween("adminTransfer", args, 2, 3); err != nil {
+		return errorFromErr(err)
+	}
+
+	from := args[0]
+	to := args[1]
+	if from == to {
+		return errorJSON(codeBadRequest, "cannot transfer to the same wallet")
+	}
+	remove := false
+	if len(args) > 2 {
+		var err error
+		remove, err = strconv.ParseBool(args[2])
+		if err != nil {
+			return errorJSON(codeBadRequest, "3rd Argument must be either true or false")
+		}
+	}
+
+	admin, err := isAdmin(stub)
+	if err != nil {
+		return errorFromErr(err)
+	} else if !admin {
+		return errorJSON(codeForbidden, "Only the admin can move the balance of a Wallet")
+	}
+
+	walletFrom, err := getWallet(stub, from)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	walletTo, err := getWallet(stub, to)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if walletFrom.Frozen {
+		return errorJSON(codeLocked, "wallet is frozen: "+from)
+	}
+	if walletTo.Frozen {
+		return errorJSON(codeLocked, "wallet is frozen: "+to)
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if walletCurrency(config, &walletFrom) != walletCurrency(config, &walletTo) {
+		return errorJSON(codeBadRequest, "currency mismatch")
+	}
+	//Money on hold isn't moved, so a Wallet that still has some can't be deleted
+	if remove && walletFrom.Held.Sign() != 0 {
+		return errorJSON(codeConflict, "wallet "+from+" still has "+formatAmount(walletFrom.Held, config.Decimals)+" on hold")
+	}
+	if remove && walletFrom.Reserved.Sign() != 0 {
+		return errorJSON(codeConflict, "wallet "+from+" still has "+formatAmount(walletFrom.Reserved, config.Decimals)+" reserved by open escrows or time locks")
+	}
+
+	//Balances are arbitrary precision, so crediting the receiver can't overflow
+	amount := walletFrom.Balance
+	toBalance := walletTo.Balance
+	walletTo.Balance = new(big.Int).Add(walletTo.Balance, amount)
+	err = saveWallet(stub, toBalance, walletTo, "adminTransfer")
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	if remove {
+		//The index entries are keyed by the stored balance, so the Wallet goes before it's emptied
+		err = removeWallet(stub, walletFrom)
+		if err != nil {
+			return errorFromErr(err)
+		}
+		err = adjustWalletCount(stub, -1)
+	} else {
+		walletFrom.Balance = new(big.Int)
+		err = saveWallet(stub, amount, walletFrom, "adminTransfer")
+	}
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	receipt := TransferReceipt{
+		TransferEvent: TransferEvent{From: from, To: to, Amount: formatAmount(amount, config.Decimals), Memo: "adminTransfer", TxID: stub.GetTxID()},
+		Fee:           formatAmount(new(big.Int), config.Decimals),
+		FromBalance:   formatAmount(new(big.Int), config.Decimals),
+		ToBalance:     formatAmount(walletTo.Balance, config.Decimals),
+	}
+	receiptAsBytes, err := recordTransfer(stub, receipt)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Println(" - END adminTransfer - ")
+	return successJSON(stub, receiptAsBytes)
+}
+
+// deleteAllWallets only runs when its argument is exactly this token
+const deleteAllConfirmation = "CONFIRM"
+
+/*
+* deleteAllWallets
+* This method removes every wallet and its index entries from the ledger, only the admin can call it
+* The records kept per wallet go with them: change logs, daily limits and what was sent against them, and allowances
+* Request ids and idempotency keys are cleared too, so they can't replay a wallet or transfer that was wiped
+* Config, supply counter, receipts, escrows and time locks are left alone, and it refuses to run while any
+* wallet still has money reserved by an open escrow or time lock
+* [confirmation]	= This must be "CONFIRM", so the ledger isn't wiped by accident
+* (JSON)		= JSON Document with the amount of wallets deleted
+ */
+
+func (t *SimpleChaincode) deleteAllWallets(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("deleteAllWallets", args, 1); err != nil {
+		return errorFromErr(err)
+	}
+	if args[0] != deleteAllConfirmation {
+		return errorJSON(codeBadRequest, "1st Argument must be \""+deleteAllConfirmation+"\" to delete every Wallet")
+	}
+
+	admin, err := isAdmin(stub)
+	if err != nil {
+		return errorFromErr(err)
+	} else if !admin {
+		return errorJSON(codeForbidden, "Only the admin can delete every Wallet")
+	}
+
+	//An open range only walks the wallet key space
+	resultsIterator, err := stub.GetStateByRange("", "")
+	if err != nil {
+		return errorFromErr(err)
+	}
+	defer resultsIterator.Close()
+
+	var wallets []Wallet
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return errorFromErr(err)
+		}
+
+		//Anything that doesn't read as a Wallet isn't ours to delete
+		wallet := Wallet{}
+		err = json.Unmarshal(queryResponse.Value, &wallet)
+		if err != nil || wallet.Address != queryResponse.Key {
+			continue
+		}
+		wallets = append(wallets, wallet)
+	}
+
+	//Open escrows and time locks would be left with no wallet to pay out of
+	for _, wallet := range wallets {
+		if wallet.Reserved.Sign() != 0 {
+			return errorJSON(codeConflict, "wallet "+wallet.Address+" still has money reserved by open escrows or time locks")
+		}
+	}
+
+	removed := new(big.Int)
+	for _, wallet := range wallets {
+		err = removeWallet(stub, wallet)
+		if err != nil {
+			return errorFromErr(err)
+		}
+		removed.Add(removed, wallet.Balance)
+		removed.Add(removed, wallet.Held)
+	}
+
+	//Retried requests and idempotent transfers would otherwise be answered for wallets that no longer exist
+	for _, index := range []string{requestIndex, idempotencyIndex} {
+		err = deleteIndex(stub, index)
+		if err != nil {
+			return errorFromErr(err)
+		}
+	}
+
+	err = reduceTotalSupply(stub, removed)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = adjustWalletCount(stub, -len(wallets))
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Printf(" - END deleteAllWallets (%d deleted) - \n", len(wallets))
+	return successJSON(stub, []byte("{\"deleted\":"+strconv.Itoa(len(wallets))+"}"))
+}
+
+/*
+* deleteIndex
+* This method deletes every record stored under a composite key index, narrowed down by any leading attributes
+ */
+
+func deleteIndex(stub shim.ChaincodeStubInterface, index string, attributes ...string) error {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(index, attributes)
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	//The keys are collected first so nothing is deleted while the iterator is still open
+	var keys []string
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		keys = append(keys, queryResponse.Key)
+	}
+
+	for _, key := range keys {
+		err = stub.DelState(key)
+		if err != nil {
+			return fmt.Errorf("Failed to delete %s record: %s", index, err.Error())
+		}
+	}
+	return nil
 }
 
 /*
-* The main method is only relevant in unit test mode.
-* Included here for completeness
+* removeWallet
+* This method deletes a wallet along with its index entries, allowances, daily limit and change log
  */
-func main() {
-	err := shim.Start(new(SimpleChaincode))
+
+func removeWallet(stub shim.ChaincodeStubInterface, wallet Wallet) error {
+	err := stub.DelState(wallet.Address)
 	if err != nil {
-		fmt.Printf("Error starting Transaction Chaincode implementation: %s", err)
+		return fmt.Errorf("Failed to delete Wallet: %s", err.Error())
+	}
+
+	addressBalanceIndexKey, err := getAddressBalanceIndexKey(stub, wallet.Address, wallet.Balance)
+	if err != nil {
+		return err
+	}
+	err = stub.DelState(addressBalanceIndexKey)
+	if err != nil {
+		return fmt.Errorf("Failed to delete Wallet index: %s", err.Error())
+	}
+	err = unindexOwner(stub, wallet.Owner, wallet.Address)
+	if err != nil {
+		return fmt.Errorf("Failed to delete Wallet index: %s", err.Error())
+	}
+
+	//A wallet recreated at the same address must not inherit any of these
+	for _, index := range []string{changeLogIndex, dailyLimitIndex, dailySentIndex, allowanceIndex} {
+		err = deleteIndex(stub, index, wallet.Address)
+		if err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 /*
-*The Init method is called when the Smart Contract 'Halley' is instantiated by the blockchain network
-* Best practice is to have any Ledger initialization as a separate function
+* computeFee
+* This method returns the fee charged for transfering an amount
  */
 
-func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
-	return shim.Success(nil)
+func computeFee(config Config, amount *big.Int) (*big.Int, error) {
+	if config.Treasury == "" {
+		return new(big.Int), nil
+	}
+	feeFlat, err := configAmount(config, "feeFlat", config.FeeFlat)
+	if err != nil {
+		return nil, err
+	}
+	fee := new(big.Int).Mul(amount, amountOf(config.FeeBasisPoints))
+	fee.Quo(fee, amountOf(10000))
+	return fee.Add(fee, feeFlat), nil
 }
 
 /*
-* The Invoke method is called as a result of an application request to the Smart Contract 'Halley'
-* The calling application program has also specified the particular smart contract function to be called, with arguments
+* configAmount
+* This method reads one of the amounts the Config holds as a decimal string, empty means zero
  */
 
-func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
-	// Retrieve the requested Smart Contract function and arguments
-	function, args := stub.GetFunctionAndParameters()
-	fmt.Println("Invoke is running: " + function)
-	//Route to the appropiate handler function to interact with the ledger appropiately
+func configAmount(config Config, name string, value string) (*big.Int, error) {
+	amount, err := parseAmount(value, config.Decimals)
+	if err != nil {
+		return nil, newError(codeBadRequest, "%s is not a valid amount: %s", name, err.Error())
+	}
+	if amount.Sign() < 0 {
+		return nil, newError(codeBadRequest, "%s must be non negative", name)
+	}
+	return amount, nil
+}
+
+/*
+* loadTreasury
+* This method returns the wallet that collects the fees of a transfer, reusing the sender or receiver when it's one of them
+ */
 
-	if function == "initWallet" {
-		return t.initWallet(stub, args)
-	} else if function == "transferFunds" {
-		return t.transferFunds(stub, args)
-	} else if function == "readWallet" {
-		return t.readWallet(stub, args)
-	} else if function == "getWalletsByRange" {
-		return t.getWalletsByRange(stub, args)
+func loadTreasury(stub shim.ChaincodeStubInterface, config Config, from *Wallet, to *Wallet) (*Wallet, error) {
+	if config.Treasury == "" {
+		return nil, nil
+	} else if config.Treasury == from.Address {
+		return from, nil
+	} else if config.Treasury == to.Address {
+		return to, nil
 	}
 
-	// If nothing was invoked, launch an error
-	fmt.Println("Invoke didn't find function: " + function)
-	return shim.Error("Received Unknown function invocation")
+	treasury, err := getWallet(stub, config.Treasury)
+	if err != nil {
+		return nil, newError(errorCode(err), "Failed to load the treasury: %s", err.Error())
+	}
+	return &treasury, nil
 }
 
 /*
-* initWallet
-* This method creates a wallet and initializes it into the system
-* [id]		= This is a number that identifies the wallet
-* [balance]	= This is the numerical balance of the account
+* walletCurrency
+* This method returns the currency of a wallet, wallets created without one hold the base currency
  */
 
-func (t *SimpleChaincode) initWallet(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	var err error
-	// 	  0			  1
-	// Address	Initial Balance
-
-	if len(args) != 2 {
-		return shim.Error("Incorrect Number of arguments, expecting 2")
+func walletCurrency(config Config, wallet *Wallet) string {
+	if wallet.Currency == "" {
+		return config.BaseCurrency
 	}
+	return wallet.Currency
+}
 
-	//Input Sanitation as this part is really important
-	fmt.Printf(" - Initializing Wallet - ")
+/*
+* checkTransfer
+* This method applies the rules every movement of money between two wallets follows, whatever moves it:
+* a positive amount, a memo above the threshold, neither wallet frozen, one currency and a KYC-verified receiver
+ */
 
-	if len(args[0]) <= 0 || len(args[0]) <= 0 {
-		return shim.Error("Arguments can't be non empty")
+func checkTransfer(config Config, callerID string, from *Wallet, to *Wallet, amount *big.Int, memo string) error {
+	if from.Address == to.Address {
+		return newError(codeBadRequest, "cannot transfer to the same wallet")
 	}
 
-	//Variable initialization
-	address := args[0]
-	balance, _ := strconv.Atoi(args[1])
-	if err != nil {
-		return shim.Error("2nd Argument must be a numeric string")
+	//Negative transfers would pull money out of the receiver and zero ones just waste a transaction
+	if amount == nil || amount.Sign() <= 0 {
+		return newError(codeBadRequest, "transfer amount must be positive")
 	}
 
-	//Create the Wallet object and convert it to bytes to save
-	Wallet := Wallet{Address: address, Balance: balance}
-	WalletJSONasBytes, err := json.Marshal(Wallet)
-	if err != nil {
-		return shim.Error(err.Error())
+	if len(memo) > maxMemoLength {
+		return newError(codeBadRequest, "memo can't be longer than %d characters, got %d", maxMemoLength, len(memo))
 	}
 
-	//Save the Wallet to the blockchain
-	err = stub.PutState(address, WalletJSONasBytes)
+	//Large transfers must state a reason so they can be audited
+	threshold, err := configAmount(config, "reasonRequiredThreshold", config.ReasonRequiredThreshold)
 	if err != nil {
-		return shim.Error(err.Error())
+		return err
+	}
+	if threshold.Sign() > 0 && amount.Cmp(threshold) > 0 && memo == "" {
+		return newError(codeBadRequest, "Transfers above %s require a memo", formatAmount(threshold, config.Decimals))
 	}
 
-	//Create an Index to look faster for Wallets
-	indexName := "address~balance"
-	addressBalanceIndexKey, err := stub.CreateCompositeKey(indexName, []string{Wallet.Address, strconv.Itoa(Wallet.Balance)})
-	if err != nil {
-		return shim.Error(err.Error())
+	//Frozen Wallets can't send nor receive money
+	if from.Frozen {
+		return newError(codeLocked, "wallet is frozen: %s", from.Address)
+	}
+	if to.Frozen {
+		return newError(codeLocked, "wallet is frozen: %s", to.Address)
 	}
 
-	//Save Index to State
-	value := []byte{0x00}
-	stub.PutState(addressBalanceIndexKey, value)
+	//Money only moves between wallets of the same denomination
+	if walletCurrency(config, from) != walletCurrency(config, to) {
+		return newError(codeBadRequest, "currency mismatch")
+	}
 
-	//Wallet saved and indexed, return success
-	fmt.Println(" - END Wallet Init - ")
-	return shim.Success(nil)
+	//Regulated deployments can only credit KYC-verified wallets, unless the admin is the one transferring
+	admin := config.Admin != "" && callerID == config.Admin
+	if config.RequireKYCForReceive && !to.KYCVerified && !admin {
+		return newError(codeForbidden, "Receiving Wallet is not KYC-verified: %s", to.Address)
+	}
+
+	return nil
 }
 
 /*
-* readWallet
-* This method returns the current state of a wallet on the ledger
-* [id]		= This is an md5 hash that identifies the wallet
-* (JSON)	= JSON Document with the current state of the wallet
+* applyTransfer
+* This method validates a transfer and applies it to the wallets in memory, nothing is written to the ledger
+* Every function that moves money between wallets goes through here so they all follow the same rules
+* It returns the fee credited to the treasury, which may be the sender or the receiver themselves
  */
 
-func (t *SimpleChaincode) readWallet(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	var address, jsonResp string
-	var err error
+func applyTransfer(config Config, callerID string, from *Wallet, to *Wallet, treasury *Wallet, amount *big.Int, memo string) (*big.Int, error) {
+	err := checkTransfer(config, callerID, from, to, amount, memo)
+	if err != nil {
+		return nil, err
+	}
 
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments, expecting the address to query")
+	//When enabled, only the owner of a Wallet can move money out of it
+	if config.EnforceOwnerAuth && callerID != from.Owner {
+		return nil, newError(codeForbidden, "caller is not the wallet owner")
 	}
 
-	address = args[0]
-	valAsBytes, err := stub.GetState(address)
-	if err != nil {
-		jsonResp = "{\"Error\":\"Failed to get state for " + address + "\"}"
-		return shim.Error(jsonResp)
-	} else if valAsBytes == nil {
-		jsonResp = "{\"Error\":\"Wallet does not exist: " + address + "\"}"
-		return shim.Error(jsonResp)
+	//The treasury doesn't pay fees to itself
+	fee := new(big.Int)
+	if treasury != nil && treasury != from {
+		fee, err = computeFee(config, amount)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if fee.Sign() > 0 && walletCurrency(config, treasury) != walletCurrency(config, from) {
+		return nil, newError(codeBadRequest, "currency mismatch with the treasury %s", treasury.Address)
+	}
+
+	//This is the main balance transfer mechanism
+	//As far as we know, this part is really simple
+	//1. Checks if an Wallet has enough funds to transfer to another Wallet, fee included
+	//2. Checks if the transfer amount is not negative (that'd be really weird)
+	//3. Then, it simply 'transfers' it.
+
+	total := new(big.Int).Add(amount, fee)
+	if from.Balance.Cmp(total) < 0 {
+		return nil, newError(codeInsufficientFunds, "Insufficient funds, the transfer needs %s including a fee of %s", formatAmount(total, config.Decimals), formatAmount(fee, config.Decimals))
 	}
 
-	return shim.Success(valAsBytes)
+	toCredit := amount
+	if treasury == to {
+		toCredit = total
+	}
+	from.Balance = new(big.Int).Sub(from.Balance, total)
+	to.Balance = new(big.Int).Add(to.Balance, toCredit)
+	if fee.Sign() > 0 && treasury != to {
+		treasury.Balance = new(big.Int).Add(treasury.Balance, fee)
+	}
+
+	return fee, nil
 }
 
 /*
@@ -173,82 +1470,377 @@ func (t *SimpleChaincode) readWallet(stub shim.ChaincodeStubInterface, args []st
 * [from]	= This is the id for a wallet that's sending money
 * [to]		= This is the id for a wallet that's receiving money
 * [balance]	= This is the amount of money that it's being transfered
+* [memo]	= (Optional) This is the reason or reference for the transfer, it's kept on the transfer record
+* (JSON)	= JSON Document with the receipt, carrying the txid and both new balances
  */
 
 func (t *SimpleChaincode) transferFunds(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	//		 0			1		   2
-	//		from		to		balance
+	//		 0			1		   2		3
+	//		from		to		balance		memo
 
-	if len(args) < 3 {
-		return shim.Error("Incorrect number of arguments. Expecting 3")
+	if err := requireArgsBetween("transferFunds", args, 3, 4); err != nil {
+		return errorFromErr(err)
 	}
 
 	//Variable setting from - to - ammount to be transfered
 	from := args[0]
 	to := args[1]
-	transfer, _ := strconv.Atoi(args[2])
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	transfer, err := parseAmount(args[2], config.Decimals)
+	if err != nil {
+		return errorJSON(codeBadRequest, "Failed to parse into Integer, 3rd Argument must be a numeric string: "+err.Error())
+	}
+
+	memo := ""
+	if len(args) > 3 {
+		memo = strings.TrimSpace(args[3])
+	}
+
+	callerID, err := getCallerID(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
 
 	//if Wallet 'from' doesn't exist, then the transfer halts
 	fromAsBytes, err := stub.GetState(from)
 	if err != nil {
-		return shim.Error("Failed to get Wallet: " + err.Error())
+		return errorJSON(codeInternal, "Failed to get Wallet: "+err.Error())
 	} else if fromAsBytes == nil {
-		return shim.Error("Wallet 1 doesn't exist")
+		return errorJSON(codeNotFound, "Wallet does not exist: "+from)
 	}
 
 	//if Wallet 'to' doesn't exist, then the transfer halts
 	toAsBytes, err := stub.GetState(to)
 	if err != nil {
-		return shim.Error("Failed to get Wallet: " + err.Error())
+		return errorJSON(codeInternal, "Failed to get Wallet: "+err.Error())
 	} else if toAsBytes == nil {
-		return shim.Error("Wallet 1 doesn't exist")
+		return errorJSON(codeNotFound, "Wallet does not exist: "+to)
 	}
 
 	//Make Wallet 'from' usable for us
-	WalletFrom := Wallet{}
-	err = json.Unmarshal(fromAsBytes, &WalletFrom)
+	WalletFrom, err := unmarshalWallet(from, fromAsBytes)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorFromErr(err)
 	}
 
 	//Make Wallet 'To' usable for us
-	WalletTo := Wallet{}
-	err = json.Unmarshal(toAsBytes, &WalletTo)
+	WalletTo, err := unmarshalWallet(to, toAsBytes)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorFromErr(err)
 	}
 
-	//This is the main balance transfer mechanism
-	//As far as we know, this part is really simple
-	//1. Checks if an Wallet has enough funds to transfer to another Wallet
-	//2. Checks if the transfer amount is not negative (that'd be really weird)
-	//3. Then, it simply 'transfers' it.
+	treasury, err := loadTreasury(stub, config, &WalletFrom, &WalletTo)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	//Both new balances are computed and serialized before anything is written,
+	//so a failure never leaves one side of the transfer saved without the other
+	fromBalance := WalletFrom.Balance
+	toBalance := WalletTo.Balance
+	fee, err := applyTransfer(config, callerID, &WalletFrom, &WalletTo, treasury, transfer, memo)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = spendDailyLimit(stub, from, transfer, config.Decimals)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	WalletFrom.UpdatedAt = timestamp
+	WalletTo.UpdatedAt = timestamp
+
+	WalletToAsBytes, err := json.Marshal(WalletTo)
+	if err != nil {
+		return errorFromErr(err)
+	}
 
-	WalletTo.Balance += transfer
-	WalletFrom.Balance -= transfer
+	WalletFromAsBytes, err := json.Marshal(WalletFrom)
+	if err != nil {
+		return errorFromErr(err)
+	}
 
 	//The state is updated to the blockchain for both
 	//the 'to' Wallet and the 'from' Wallet
 
-	WalletToAsBytes, _ := json.Marshal(WalletTo)
 	err = stub.PutState(to, WalletToAsBytes)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorJSON(codeInternal, "Error saving the state of wallet [T] "+to+": "+err.Error())
 	}
 
-	WalletFromAsBytes, _ := json.Marshal(WalletFrom)
 	err = stub.PutState(from, WalletFromAsBytes)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorJSON(codeInternal, "Error saving the state of wallet [F] "+from+": "+err.Error())
+	}
+
+	//Keep the balance index pointing at the new balances
+	err = reindexWallet(stub, toBalance, WalletTo)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = reindexWallet(stub, fromBalance, WalletFrom)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	//Both sides of the transfer are recorded on their change logs
+	err = appendChangeLog(stub, from, "transferFunds", new(big.Int).Neg(new(big.Int).Add(transfer, fee)))
+	if err != nil {
+		return errorFromErr(err)
+	}
+	toDelta := transfer
+	if treasury == &WalletTo {
+		toDelta = new(big.Int).Add(transfer, fee)
+	}
+	err = appendChangeLog(stub, to, "transferFunds", toDelta)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	//A treasury that isn't part of the transfer gets saved on its own
+	err = creditTreasury(stub, treasury, &WalletFrom, &WalletTo, fee)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	receipt := TransferReceipt{
+		TransferEvent: TransferEvent{From: from, To: to, Amount: formatAmount(transfer, config.Decimals), Memo: memo, TxID: stub.GetTxID()},
+		Fee:           formatAmount(fee, config.Decimals),
+		FromBalance:   formatAmount(WalletFrom.Balance, config.Decimals),
+		ToBalance:     formatAmount(WalletTo.Balance, config.Decimals),
+	}
+	//The receipt carries the txid and both resulting balances back to the caller
+	receiptAsBytes, err := recordTransfer(stub, receipt)
+	if err != nil {
+		return errorFromErr(err)
 	}
 
 	fmt.Println(" - END Transaction (success) - ")
-	return shim.Success(nil)
+	return successJSON(stub, receiptAsBytes)
+}
+
+/*
+* transferFundsWithMemo
+* This method is transferFunds with the memo required, it's kept on the receipt of the transfer
+* [from]	= This is the id for a wallet that's sending money
+* [to]		= This is the id for a wallet that's receiving money
+* [balance]	= This is the amount of money that it's being transfered
+* [memo]	= This is the reason or reference for the transfer
+* (JSON)	= JSON Document with the receipt, carrying the txid, the memo and both new balances
+ */
+
+func (t *SimpleChaincode) transferFundsWithMemo(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("transferFundsWithMemo", args, 4); err != nil {
+		return errorFromErr(err)
+	}
+	if strings.TrimSpace(args[3]) == "" {
+		return errorJSON(codeBadRequest, "4th Argument can't be empty")
+	}
+	return t.transferFunds(stub, args)
+}
+
+/*
+* transferPercent
+* This method transfers a percentage of the current balance of a wallet, rounded down to whole minor units
+* Fees come on top of the amount, so 100% only goes through when no fee is charged
+* [from]	= This is the id for a wallet that's sending money
+* [to]		= This is the id for a wallet that's receiving money
+* [percent]	= This is the whole percentage of the balance being transfered, from 1 to 100
+* [memo]	= (Optional) This is the reason or reference for the transfer, it's kept on the transfer record
+* (JSON)	= JSON Document with the receipt, carrying the txid and both new balances
+ */
+
+func (t *SimpleChaincode) transferPercent(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//		 0			1		   2		3
+	//		from		to		percent		memo
+
+	if err := requireArgsBetween("transferPercent", args, 3, 4); err != nil {
+		return errorFromErr(err)
+	}
+
+	percent, err := strconv.Atoi(args[2])
+	if err != nil || percent < 1 || percent > 100 {
+		return errorJSON(codeBadRequest, "3rd Argument must be a whole percentage from 1 to 100")
+	}
+
+	wallet, err := getWallet(stub, args[0])
+	if err != nil {
+		return errorFromErr(err)
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	//The balance is read in the same transaction, so it can't change between computing the amount and moving it
+	amount := new(big.Int).Mul(wallet.Balance, amountOf(percent))
+	amount.Quo(amount, amountOf(100))
+
+	transferArgs := []string{args[0], args[1], formatAmount(amount, config.Decimals)}
+	return t.transferFunds(stub, append(transferArgs, args[3:]...))
+}
+
+/*
+* transferAdmin
+* This method hands the administrative functions over to a new identity, only the admin can call it
+* An issuer that was the admin moves along with it, a separately configured issuer is left alone
+* [admin]	= This is the identity of the new admin
+ */
+
+func (t *SimpleChaincode) transferAdmin(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("transferAdmin", args, 1); err != nil {
+		return errorFromErr(err)
+	}
+	if err := requireNonEmpty(args[0]); err != nil {
+		return errorFromErr(err)
+	}
+
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	callerID, err := getCallerID(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if config.Admin == "" || callerID != config.Admin {
+		return errorJSON(codeForbidden, "Only the admin can transfer the admin role")
+	}
+
+	if config.Issuer == config.Admin {
+		config.Issuer = args[0]
+	}
+	config.Admin = args[0]
+	err = putConfig(stub, config)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Println(" - END transferAdmin - ")
+	return successJSON(stub, nil)
+}
+
+/*
+* setKYCStatus
+* This method marks a wallet as KYC-verified or not, only the admin can call it
+* [id]		= This is the id for the wallet being reviewed
+* [status]	= This is either "true" or "false"
+ */
+
+func (t *SimpleChaincode) setKYCStatus(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//		 0			1
+	//	  Address	  Status
+
+	if err := requireArgs("setKYCStatus", args, 2); err != nil {
+		return errorFromErr(err)
+	}
+
+	admin, err := isAdmin(stub)
+	if err != nil {
+		return errorFromErr(err)
+	} else if !admin {
+		return errorJSON(codeForbidden, "Only the admin can set the KYC status of a Wallet")
+	}
+
+	address := args[0]
+	status, err := strconv.ParseBool(args[1])
+	if err != nil {
+		return errorJSON(codeBadRequest, "2nd Argument must be either true or false")
+	}
+
+	wallet, err := getWallet(stub, address)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	wallet.KYCVerified = status
+	err = putWallet(stub, wallet)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	err = appendChangeLog(stub, address, "setKYCStatus", new(big.Int))
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Println(" - END setKYCStatus - ")
+	return successJSON(stub, nil)
+}
+
+/*
+* updateOwner
+* This method hands a wallet over to a new owner
+* [id]		= This is the id for the wallet
+* [owner]	= This is the new holder of the wallet
+ */
+
+func (t *SimpleChaincode) updateOwner(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//		 0			1
+	//	  Address	 newOwner
+
+	if err := requireArgs("updateOwner", args, 2); err != nil {
+		return errorFromErr(err)
+	}
+
+	address := args[0]
+	owner := args[1]
+	if err := requireNonEmpty(args[:2]...); err != nil {
+		return errorFromErr(err)
+	}
+
+	wallet, err := getWallet(stub, address)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	//When owner authorization is enabled, only the current owner or the admin can give the Wallet away
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	callerID, err := getCallerID(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	admin := config.Admin != "" && callerID == config.Admin
+	if config.EnforceOwnerAuth && callerID != wallet.Owner && !admin {
+		return errorJSON(codeForbidden, "caller is not the wallet owner")
+	}
+
+	err = unindexOwner(stub, wallet.Owner, address)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = indexOwner(stub, owner, address)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	wallet.Owner = owner
+	err = putWallet(stub, wallet)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	err = appendChangeLog(stub, address, "updateOwner", new(big.Int))
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Println(" - END updateOwner - ")
+	return successJSON(stub, nil)
 }
 
 func (t *SimpleChaincode) getWalletsByRange(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	if len(args) < 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
+	if err := requireArgs("getWalletsByRange", args, 2); err != nil {
+		return errorFromErr(err)
 	}
 
 	startKey := args[0]
@@ -256,36 +1848,15 @@ func (t *SimpleChaincode) getWalletsByRange(stub shim.ChaincodeStubInterface, ar
 
 	resultsIterator, err := stub.GetStateByRange(startKey, endKey)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorFromErr(err)
 	}
 	defer resultsIterator.Close()
 
-	//Buffer is a JSON Array containing QueryResults
-	var buffer bytes.Buffer
-	buffer.WriteString("[")
+	buffer, err := constructQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return errorFromErr(err)
+	}
 
-	bArrayMemberAlreadyWritten := false
-	for resultsIterator.HasNext() {
-		queryResponse, err := resultsIterator.Next()
-		if err != nil {
-			return shim.Error(err.Error())
-		}
-		//Add a comma before array members, supress ir for the first array member
-		if bArrayMemberAlreadyWritten == true {
-			buffer.WriteString(",")
-		}
-		buffer.WriteString("{\"Key\":")
-		buffer.WriteString("\"")
-		buffer.WriteString(queryResponse.Key)
-		buffer.WriteString("\"")
-
-		buffer.WriteString(", \"Record\":")
-		//Record is a JSON object, so we write as-is
-		buffer.WriteString(string(queryResponse.Value))
-		buffer.WriteString("}")
-		bArrayMemberAlreadyWritten = true
-	}
-	buffer.WriteString("]")
 	fmt.Printf("- get Wallet by RANGE queryResult:\n%s\n", buffer.String())
-	return shim.Success(buffer.Bytes())
+	return successJSON(stub, buffer.Bytes())
 }
@@ -0,0 +1,1591 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Like the peer, an open range starts here so composite keys, which start with U+0000, never show up on it
+const emptyKeySubstitute = "\x01"
+
+/*
+* Define the testStub Structure, it's a shim.MockStub that behaves like a peer around the transactions it runs
+* [MockStub] <-- Ledger state, txid and composite keys
+* [t] <-- Test the stub reports to
+* [cc] <-- Chaincode the transactions run on
+* [args] <-- Function and arguments of the running transaction
+* [creator] <-- Serialized identity that submits the running transaction
+* [txCount] <-- Amount of transactions run, the txids count up with it
+* [now] <-- Time of the running transaction, every transaction moves it a second forward
+* [eventName] <-- Name of the event the last transaction set, Fabric only keeps one per transaction
+* [eventPayload] <-- Payload of that event
+* [history] <-- Every value a key had in committed transactions, for GetHistoryForKey
+* [couchDB] <-- Flag that makes rich queries work, like a peer whose state database is CouchDB
+* [failPut] <-- Key whose writes fail, to reach the branches that handle write errors
+ */
+type testStub struct {
+	*shim.MockStub
+	t            *testing.T
+	cc           *SimpleChaincode
+	args         []string
+	creator      []byte
+	txCount      int
+	now          time.Time
+	eventName    string
+	eventPayload []byte
+	history      map[string][]*queryresult.KeyModification
+	couchDB      bool
+	failPut      string
+}
+
+/*
+* newTestStub
+* This method returns a stub whose chaincode wasn't instantiated yet
+ */
+
+func newTestStub(t *testing.T) *testStub {
+	cc := new(SimpleChaincode)
+	return &testStub{
+		MockStub: shim.NewMockStub("halley", cc),
+		t:        t,
+		cc:       cc,
+		now:      time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC),
+		history:  map[string][]*queryresult.KeyModification{},
+	}
+}
+
+/*
+* run
+* This method runs one transaction, a failed one is discarded like the peer would, so it leaves no writes behind
+ */
+
+func (s *testStub) run(name string, init bool, args []string) pb.Response {
+	s.txCount++
+	txID := fmt.Sprintf("tx%04d", s.txCount)
+	s.now = s.now.Add(time.Second)
+	s.args = args
+	s.creator = identity(s.t, name)
+	s.eventName = ""
+	s.eventPayload = nil
+
+	committed := make(map[string][]byte, len(s.State))
+	for key, value := range s.State {
+		committed[key] = value
+	}
+
+	s.MockTransactionStart(txID)
+	defer s.MockTransactionEnd(txID)
+
+	var response pb.Response
+	if init {
+		response = s.cc.Init(s)
+	} else {
+		response = s.cc.Invoke(s)
+	}
+
+	if response.Status >= shim.ERRORTHRESHOLD {
+		s.restore(committed)
+	} else {
+		s.recordHistory(txID, committed)
+	}
+	return response
+}
+
+/*
+* restore
+* This method puts the state back to what it was before a failed transaction
+ */
+
+func (s *testStub) restore(committed map[string][]byte) {
+	keys := []string{}
+	for key := range s.State {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		if _, ok := committed[key]; !ok {
+			s.MockStub.DelState(key)
+		}
+	}
+	for key, value := range committed {
+		if !bytes.Equal(s.State[key], value) {
+			s.MockStub.PutState(key, value)
+		}
+	}
+}
+
+/*
+* recordHistory
+* This method keeps every key a committed transaction wrote, for GetHistoryForKey
+ */
+
+func (s *testStub) recordHistory(txID string, committed map[string][]byte) {
+	txTimestamp, _ := s.GetTxTimestamp()
+	for key, value := range s.State {
+		if old, ok := committed[key]; !ok || !bytes.Equal(old, value) {
+			s.history[key] = append(s.history[key], &queryresult.KeyModification{TxId: txID, Value: value, Timestamp: txTimestamp})
+		}
+	}
+	for key := range committed {
+		if _, ok := s.State[key]; !ok {
+			s.history[key] = append(s.history[key], &queryresult.KeyModification{TxId: txID, Timestamp: txTimestamp, IsDelete: true})
+		}
+	}
+}
+
+/*
+* tamper
+* This method writes the state directly, outside of the chaincode, e.g. to corrupt a record
+ */
+
+func (s *testStub) tamper(key string, value []byte) {
+	s.MockTransactionStart("tamper")
+	defer s.MockTransactionEnd("tamper")
+	if value == nil {
+		s.MockStub.DelState(key)
+		return
+	}
+	s.MockStub.PutState(key, value)
+}
+
+func (s *testStub) GetArgs() [][]byte {
+	args := make([][]byte, 0, len(s.args))
+	for _, arg := range s.args {
+		args = append(args, []byte(arg))
+	}
+	return args
+}
+
+func (s *testStub) GetStringArgs() []string {
+	return s.args
+}
+
+func (s *testStub) GetFunctionAndParameters() (string, []string) {
+	if len(s.args) == 0 {
+		return "", []string{}
+	}
+	return s.args[0], s.args[1:]
+}
+
+func (s *testStub) GetCreator() ([]byte, error) {
+	return s.creator, nil
+}
+
+func (s *testStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return &timestamp.Timestamp{Seconds: s.now.Unix(), Nanos: int32(s.now.Nanosecond())}, nil
+}
+
+func (s *testStub) SetEvent(name string, payload []byte) error {
+	if name == "" {
+		return fmt.Errorf("event name can not be nil string")
+	}
+	s.eventName = name
+	s.eventPayload = payload
+	return nil
+}
+
+func (s *testStub) PutState(key string, value []byte) error {
+	if key == s.failPut {
+		return fmt.Errorf("write to %s failed", key)
+	}
+	return s.MockStub.PutState(key, value)
+}
+
+/*
+* scan
+* This method returns the records between two keys in key order, an empty end key runs to the end
+ */
+
+func (s *testStub) scan(startKey string, endKey string) []*queryresult.KV {
+	iterator, err := s.MockStub.GetStateByRange("", "")
+	if err != nil {
+		s.t.Fatalf("Failed to scan the state: %s", err)
+	}
+	defer iterator.Close()
+
+	kvs := []*queryresult.KV{}
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+		if err != nil {
+			s.t.Fatalf("Failed to scan the state: %s", err)
+		}
+		if kv.Key >= startKey && (endKey == "" || kv.Key < endKey) {
+			kvs = append(kvs, kv)
+		}
+	}
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	return kvs
+}
+
+func (s *testStub) GetStateByRange(startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	if startKey == "" {
+		startKey = emptyKeySubstitute
+	}
+	return &testIterator{kvs: s.scan(startKey, endKey)}, nil
+}
+
+func (s *testStub) GetStateByRangeWithPagination(startKey, endKey string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	if startKey == "" {
+		startKey = emptyKeySubstitute
+	}
+	//The bookmark is the key the next page starts at
+	if bookmark != "" {
+		startKey = bookmark
+	}
+	iterator, metadata := paginate(s.scan(startKey, endKey), pageSize)
+	return iterator, metadata, nil
+}
+
+func (s *testStub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	if !s.couchDB {
+		return s.MockStub.GetQueryResult(query)
+	}
+	kvs, err := s.selectRecords(query, "")
+	if err != nil {
+		return nil, err
+	}
+	return &testIterator{kvs: kvs}, nil
+}
+
+func (s *testStub) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	if !s.couchDB {
+		return s.MockStub.GetQueryResultWithPagination(query, pageSize, bookmark)
+	}
+	kvs, err := s.selectRecords(query, bookmark)
+	if err != nil {
+		return nil, nil, err
+	}
+	iterator, metadata := paginate(kvs, pageSize)
+	return iterator, metadata, nil
+}
+
+func (s *testStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return &testHistoryIterator{modifications: s.history[key]}, nil
+}
+
+/*
+* selectRecords
+* This method runs the part of a CouchDB query the tests use: equality and comparisons on top level fields
+ */
+
+func (s *testStub) selectRecords(query string, bookmark string) ([]*queryresult.KV, error) {
+	request := struct {
+		Selector map[string]interface{} `json:"selector"`
+		Limit    int                    `json:"limit"`
+	}{}
+	err := json.Unmarshal([]byte(query), &request)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query %s: %s", query, err)
+	}
+
+	kvs := []*queryresult.KV{}
+	for _, kv := range s.scan(bookmark, "") {
+		document := map[string]interface{}{}
+		if json.Unmarshal(kv.Value, &document) != nil || !matchesSelector(document, request.Selector) {
+			continue
+		}
+		kvs = append(kvs, kv)
+		if request.Limit > 0 && len(kvs) == request.Limit {
+			break
+		}
+	}
+	return kvs, nil
+}
+
+/*
+* matchesSelector
+* This method checks a document against every field of a selector
+ */
+
+func matchesSelector(document map[string]interface{}, selector map[string]interface{}) bool {
+	for field, condition := range selector {
+		value, ok := document[field]
+		if !ok {
+			return false
+		}
+		operators, isOperators := condition.(map[string]interface{})
+		if !isOperators {
+			operators = map[string]interface{}{"$eq": condition}
+		}
+		for operator, operand := range operators {
+			if !compareSelector(value, operator, operand) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+/*
+* compareSelector
+* This method applies one selector operator, values of different types never match
+ */
+
+func compareSelector(value interface{}, operator string, operand interface{}) bool {
+	cmp := 0
+	switch v := value.(type) {
+	case float64:
+		o, ok := operand.(float64)
+		if !ok {
+			return false
+		}
+		if v < o {
+			cmp = -1
+		} else if v > o {
+			cmp = 1
+		}
+	case string:
+		o, ok := operand.(string)
+		if !ok {
+			return false
+		}
+		cmp = strings.Compare(v, o)
+	case bool:
+		o, ok := operand.(bool)
+		if !ok || v != o {
+			cmp = 1
+		}
+	default:
+		return false
+	}
+
+	switch operator {
+	case "$eq":
+		return cmp == 0
+	case "$ne":
+		return cmp != 0
+	case "$gt":
+		return cmp > 0
+	case "$gte":
+		return cmp >= 0
+	case "$lt":
+		return cmp < 0
+	case "$lte":
+		return cmp <= 0
+	}
+	return false
+}
+
+/*
+* paginate
+* This method cuts a page off some records, the bookmark is the key the next page starts at, empty on the last one
+ */
+
+func paginate(kvs []*queryresult.KV, pageSize int32) (*testIterator, *pb.QueryResponseMetadata) {
+	bookmark := ""
+	if len(kvs) > int(pageSize) {
+		bookmark = kvs[pageSize].Key
+		kvs = kvs[:pageSize]
+	}
+	return &testIterator{kvs: kvs}, &pb.QueryResponseMetadata{FetchedRecordsCount: int32(len(kvs)), Bookmark: bookmark}
+}
+
+/*
+* Define the testIterator Structure, it hands out records the testStub already selected
+ */
+type testIterator struct {
+	kvs []*queryresult.KV
+}
+
+func (it *testIterator) HasNext() bool {
+	return len(it.kvs) > 0
+}
+
+func (it *testIterator) Next() (*queryresult.KV, error) {
+	if len(it.kvs) == 0 {
+		return nil, fmt.Errorf("no more records")
+	}
+	kv := it.kvs[0]
+	it.kvs = it.kvs[1:]
+	return kv, nil
+}
+
+func (it *testIterator) Close() error {
+	return nil
+}
+
+/*
+* Define the testHistoryIterator Structure, it hands out the history of a key, oldest first
+ */
+type testHistoryIterator struct {
+	modifications []*queryresult.KeyModification
+}
+
+func (it *testHistoryIterator) HasNext() bool {
+	return len(it.modifications) > 0
+}
+
+func (it *testHistoryIterator) Next() (*queryresult.KeyModification, error) {
+	if len(it.modifications) == 0 {
+		return nil, fmt.Errorf("no more modifications")
+	}
+	modification := it.modifications[0]
+	it.modifications = it.modifications[1:]
+	return modification, nil
+}
+
+func (it *testHistoryIterator) Close() error {
+	return nil
+}
+
+// Every name gets one self-signed certificate, so it keeps the same identity across stubs
+var identities = map[string][]byte{}
+
+/*
+* identity
+* This method returns the serialized identity a client with that name submits transactions with
+ */
+
+func identity(t *testing.T, name string) []byte {
+	if creator, ok := identities[name]; ok {
+		return creator
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate a key for %s: %s", name, err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(int64(len(identities) + 1)),
+		Subject:      pkix.Name{CommonName: name, Organization: []string{"Org1"}},
+		NotBefore:    time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2037, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create a certificate for %s: %s", name, err)
+	}
+
+	creator, err := proto.Marshal(&msp.SerializedIdentity{Mspid: "Org1MSP", IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate})})
+	if err != nil {
+		t.Fatalf("Failed to serialize the identity of %s: %s", name, err)
+	}
+	identities[name] = creator
+	return creator
+}
+
+/*
+* idOf
+* This method returns the caller id the chaincode sees for a client, e.g. to make them an owner or spender
+ */
+
+func (s *testStub) idOf(name string) string {
+	creator := s.creator
+	defer func() { s.creator = creator }()
+
+	s.creator = identity(s.t, name)
+	id, err := cid.GetID(s)
+	if err != nil {
+		s.t.Fatalf("Failed to get the id of %s: %s", name, err)
+	}
+	return id
+}
+
+/*
+* addressOf
+* This method returns the wallet address the tests give a name, the md5 hash of it
+ */
+
+func addressOf(name string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(name)))
+}
+
+/*
+* init
+* This method instantiates or upgrades 'Halley' as a client
+ */
+
+func (s *testStub) init(name string, args ...string) pb.Response {
+	return s.run(name, true, append([]string{"init"}, args...))
+}
+
+/*
+* instantiate
+* This method instantiates 'Halley' with a config, submitted by the admin identity
+ */
+
+func (s *testStub) instantiate(config Config) {
+	s.t.Helper()
+	configAsBytes, err := json.Marshal(config)
+	if err != nil {
+		s.t.Fatalf("Failed to marshal the config: %s", err)
+	}
+	if response := s.init("admin", string(configAsBytes)); response.Status != shim.OK {
+		s.t.Fatalf("Init failed: %s", response.Message)
+	}
+}
+
+/*
+* Define the caller Structure, it invokes the chaincode as one client
+ */
+type caller struct {
+	s    *testStub
+	name string
+}
+
+func (s *testStub) as(name string) caller {
+	return caller{s: s, name: name}
+}
+
+/*
+* invoke
+* This method invokes a function and reads the Response it answered with
+ */
+
+func (c caller) invoke(function string, args ...string) Response {
+	return decodeResponse(c.s.t, c.s.run(c.name, false, append([]string{function}, args...)))
+}
+
+/*
+* ok
+* This method invokes a function that has to succeed
+ */
+
+func (c caller) ok(function string, args ...string) Response {
+	c.s.t.Helper()
+	response := c.invoke(function, args...)
+	if response.Status != codeOK {
+		c.s.t.Fatalf("%s(%s) failed with %d: %s", function, strings.Join(args, ", "), response.Status, response.Message)
+	}
+	return response
+}
+
+/*
+* fails
+* This method invokes a function that has to fail with a code
+ */
+
+func (c caller) fails(code int, function string, args ...string) Response {
+	c.s.t.Helper()
+	response := c.invoke(function, args...)
+	if response.Status != code {
+		c.s.t.Fatalf("%s(%s) answered %d instead of %d: %s", function, strings.Join(args, ", "), response.Status, code, response.Message)
+	}
+	return response
+}
+
+func (s *testStub) invoke(function string, args ...string) Response {
+	return s.as("admin").invoke(function, args...)
+}
+
+func (s *testStub) ok(function string, args ...string) Response {
+	s.t.Helper()
+	return s.as("admin").ok(function, args...)
+}
+
+func (s *testStub) fails(code int, function string, args ...string) Response {
+	s.t.Helper()
+	return s.as("admin").fails(code, function, args...)
+}
+
+/*
+* decodeResponse
+* This method reads the Response out of the payload on success and out of the message on failure
+ */
+
+func decodeResponse(t *testing.T, peerResponse pb.Response) Response {
+	raw := peerResponse.Payload
+	if peerResponse.Status >= shim.ERRORTHRESHOLD {
+		raw = []byte(peerResponse.Message)
+	}
+
+	response := Response{}
+	err := json.Unmarshal(raw, &response)
+	if err != nil {
+		t.Fatalf("Response is not JSON: %s (%q)", err, raw)
+	}
+	if int32(response.Status) != peerResponse.Status {
+		t.Fatalf("Response status %d doesn't match the peer status %d", response.Status, peerResponse.Status)
+	}
+	return response
+}
+
+/*
+* decode
+* This method unmarshals the data of a Response or an event
+ */
+
+func decode(t *testing.T, data []byte, v interface{}) {
+	t.Helper()
+	err := json.Unmarshal(data, v)
+	if err != nil {
+		t.Fatalf("Failed to decode %s: %s", data, err)
+	}
+}
+
+/*
+* createWallet
+* This method creates the wallet of a name as the admin, the optional arguments follow the balance like in initWallet
+ */
+
+func (s *testStub) createWallet(name string, balance string, args ...string) string {
+	s.t.Helper()
+	address := addressOf(name)
+	s.ok("initWallet", append([]string{address, balance}, args...)...)
+	return address
+}
+
+/*
+* wallet
+* This method reads a wallet straight from the state
+ */
+
+func (s *testStub) wallet(address string) Wallet {
+	s.t.Helper()
+	wallet, err := getWallet(s, address)
+	if err != nil {
+		s.t.Fatalf("Failed to read wallet %s: %s", address, err)
+	}
+	return wallet
+}
+
+func (s *testStub) expectBalance(address string, balance string) {
+	s.t.Helper()
+	if got := s.wallet(address).Balance.String(); got != balance {
+		s.t.Fatalf("wallet %s has a balance of %s, expected %s", address, got, balance)
+	}
+}
+
+func (s *testStub) expectSupply(totalSupply string) {
+	s.t.Helper()
+	got, err := readTotalSupply(s)
+	if err != nil {
+		s.t.Fatalf("Failed to read the total supply: %s", err)
+	}
+	if got.String() != totalSupply {
+		s.t.Fatalf("total supply is %s, expected %s", got, totalSupply)
+	}
+}
+
+func (s *testStub) expectEvent(name string, event interface{}) {
+	s.t.Helper()
+	if s.eventName != name {
+		s.t.Fatalf("last event is %q, expected %q", s.eventName, name)
+	}
+	decode(s.t, s.eventPayload, event)
+}
+
+func (s *testStub) compositeKey(index string, attributes ...string) string {
+	s.t.Helper()
+	key, err := s.CreateCompositeKey(index, attributes)
+	if err != nil {
+		s.t.Fatalf("Failed to create a composite key: %s", err)
+	}
+	return key
+}
+
+func expectMessage(t *testing.T, response Response, message string) {
+	t.Helper()
+	if !strings.Contains(response.Message, message) {
+		t.Fatalf("message %q doesn't contain %q", response.Message, message)
+	}
+}
+
+/*
+* Define the queryRecord Structure, it's one {Key, Record} object of the query results
+ */
+type queryRecord struct {
+	Key    string `json:"Key"`
+	Record Wallet `json:"Record"`
+}
+
+func recordKeys(records []queryRecord) []string {
+	keys := []string{}
+	for _, record := range records {
+		keys = append(keys, record.Key)
+	}
+	return keys
+}
+
+func expectKeys(t *testing.T, got []string, expected ...string) {
+	t.Helper()
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Fatalf("got %v, expected %v", got, expected)
+	}
+}
+
+func TestCreateAndQueryWallet(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+
+	for _, function := range []string{"queryWallet", "readWallet"} {
+		wallet := Wallet{}
+		decode(t, s.ok(function, alice).Data, &wallet)
+		if wallet.Address != alice || wallet.Balance.String() != "100" {
+			t.Fatalf("%s returned %+v", function, wallet)
+		}
+		if wallet.Owner != s.idOf("admin") {
+			t.Fatalf("wallet is owned by %q instead of its creator", wallet.Owner)
+		}
+	}
+
+	expectMessage(t, s.fails(codeNotFound, "queryWallet", addressOf("nobody")), "Wallet does not exist: "+addressOf("nobody"))
+}
+
+func TestTransferFunds(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "50")
+
+	s.ok("transferFunds", alice, bob, "30")
+	s.expectBalance(alice, "70")
+	s.expectBalance(bob, "80")
+
+	//Transfers only move money around, so the supply stays the same
+	s.expectSupply("150")
+}
+
+func TestTransferInsufficientFunds(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "0")
+
+	expectMessage(t, s.fails(codeInsufficientFunds, "transferFunds", alice, bob, "101"), "Insufficient funds")
+	s.expectBalance(alice, "100")
+	s.expectBalance(bob, "0")
+
+	s.ok("transferFunds", alice, bob, "100")
+	s.expectBalance(alice, "0")
+	s.expectBalance(bob, "100")
+}
+
+func TestDeleteWallet(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "50")
+
+	s.ok("deleteWallet", alice)
+	s.fails(codeNotFound, "queryWallet", alice)
+	s.fails(codeNotFound, "deleteWallet", alice)
+	s.fails(codeNotFound, "transferFunds", bob, alice, "10")
+	s.expectBalance(bob, "50")
+}
+
+func TestKYCForReceive(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY", RequireKYCForReceive: true})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "0")
+
+	expectMessage(t, s.as("alice").fails(codeForbidden, "transferFunds", alice, bob, "10"), "Receiving Wallet is not KYC-verified: "+bob)
+	s.expectBalance(bob, "0")
+
+	s.ok("setKYCStatus", bob, "true")
+	s.as("alice").ok("transferFunds", alice, bob, "10")
+	s.expectBalance(bob, "10")
+
+	//The admin isn't held to the policy
+	carol := s.createWallet("carol", "0")
+	s.ok("transferFunds", alice, carol, "10")
+	s.expectBalance(carol, "10")
+}
+
+func TestReasonThreshold(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY", ReasonRequiredThreshold: "100"})
+	alice := s.createWallet("alice", "1000")
+	bob := s.createWallet("bob", "0")
+
+	expectMessage(t, s.fails(codeBadRequest, "transferFunds", alice, bob, "150"), "Transfers above 100 require a memo")
+	s.fails(codeBadRequest, "transferFunds", alice, bob, "150", "   ")
+	s.ok("transferFunds", alice, bob, "150", "quarterly payout")
+	s.ok("transferFunds", alice, bob, "50")
+	s.ok("transferFunds", alice, bob, "100")
+	s.expectBalance(bob, "300")
+}
+
+func TestWalletJSONRoundTrip(t *testing.T) {
+	balance, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	wallet := Wallet{Address: addressOf("alice"), Balance: balance, Held: big.NewInt(5), Reserved: big.NewInt(7), Owner: "alice", Currency: "EUR"}
+
+	walletAsBytes, err := json.Marshal(wallet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(walletAsBytes), "\"balance\":\"123456789012345678901234567890\"") {
+		t.Fatalf("balance isn't saved as a decimal string: %s", walletAsBytes)
+	}
+	if !strings.Contains(string(walletAsBytes), "\"balanceValue\":123456789012345678901234567890") {
+		t.Fatalf("balanceValue isn't saved as a number: %s", walletAsBytes)
+	}
+
+	loaded := Wallet{}
+	decode(t, walletAsBytes, &loaded)
+	if loaded.Balance.Cmp(balance) != 0 || loaded.Held.Int64() != 5 || loaded.Reserved.Int64() != 7 || loaded.Owner != "alice" || loaded.Currency != "EUR" {
+		t.Fatalf("wallet didn't survive the round trip: %+v", loaded)
+	}
+
+	//Wallets saved before the balances were strings still load
+	legacy := Wallet{}
+	decode(t, []byte("{\"address\":\"a\",\"balance\":150}"), &legacy)
+	if legacy.Balance.Int64() != 150 || legacy.Held.Sign() != 0 || legacy.Reserved.Sign() != 0 {
+		t.Fatalf("legacy wallet didn't load: %+v", legacy)
+	}
+}
+
+func TestTransferRejectsBadAmounts(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "0")
+
+	expectMessage(t, s.fails(codeBadRequest, "transferFunds", alice, bob, "-100"), "transfer amount must be positive")
+	expectMessage(t, s.fails(codeBadRequest, "transferFunds", alice, bob, "-1"), "transfer amount must be positive")
+	expectMessage(t, s.fails(codeBadRequest, "transferFunds", alice, bob, "0"), "transfer amount must be positive")
+	expectMessage(t, s.fails(codeBadRequest, "transferFunds", alice, bob, "abc"), "Failed to parse into Integer")
+	expectMessage(t, s.fails(codeInsufficientFunds, "transferFunds", alice, bob, "101"), "Insufficient funds")
+	s.expectBalance(alice, "100")
+	s.expectBalance(bob, "0")
+
+	s.ok("transferFunds", alice, bob, "1")
+	s.expectBalance(bob, "1")
+}
+
+func TestLargeAmounts(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	maxInt64 := fmt.Sprint(int64(math.MaxInt64))
+	alice := s.createWallet("alice", maxInt64)
+	bob := s.createWallet("bob", maxInt64)
+
+	//The receiver ends up past MaxInt64 instead of overflowing
+	s.ok("transferFunds", alice, bob, maxInt64)
+	s.expectBalance(alice, "0")
+	s.expectBalance(bob, "18446744073709551614")
+
+	s.ok("mint", alice, "100000000000000000000")
+	s.ok("transferFunds", alice, bob, "99999999999999999999")
+	s.expectBalance(alice, "1")
+	s.expectBalance(bob, "118446744073709551613")
+	s.expectSupply("118446744073709551614")
+
+	balance := struct {
+		Balance string `json:"balance"`
+	}{}
+	decode(t, s.ok("getBalance", bob).Data, &balance)
+	if balance.Balance != "118446744073709551613" {
+		t.Fatalf("getBalance returned %s", balance.Balance)
+	}
+}
+
+func TestSelfTransfer(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+
+	expectMessage(t, s.fails(codeBadRequest, "transferFunds", alice, alice, "10"), "cannot transfer to the same wallet")
+	s.expectBalance(alice, "100")
+}
+
+func TestCreateWalletTwiceKeepsBalance(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+
+	expectMessage(t, s.fails(codeConflict, "initWallet", alice, "5"), "wallet already exists: "+alice)
+	s.expectBalance(alice, "100")
+	s.expectSupply("100")
+}
+
+func TestFailedWriteLeavesNoState(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "0")
+
+	//transferFunds saves the receiver first and the sender second
+	s.failPut = bob
+	expectMessage(t, s.fails(codeInternal, "transferFunds", alice, bob, "10"), "Error saving the state of wallet [T] "+bob+": write to "+bob+" failed")
+	s.failPut = alice
+	expectMessage(t, s.fails(codeInternal, "transferFunds", alice, bob, "10"), "Error saving the state of wallet [F] "+alice+": write to "+alice+" failed")
+	if s.eventName != "" {
+		t.Fatalf("failed transfer emitted a %s", s.eventName)
+	}
+	s.failPut = s.compositeKey(changeLogIndex, alice)
+	s.fails(codeInternal, "transferFunds", alice, bob, "10")
+
+	s.failPut = ""
+	s.expectBalance(alice, "100")
+	s.expectBalance(bob, "0")
+	if left := s.scan(s.compositeKey(transferRecordIndex), s.compositeKey(transferRecordIndex)+string(rune(0x10FFFF))); len(left) != 0 {
+		t.Fatalf("failed transfers left %d receipts", len(left))
+	}
+
+	//Failed creations leave no wallet, index or supply behind either
+	s.failPut = s.compositeKey(walletCountIndex)
+	s.fails(codeInternal, "initWallet", addressOf("carol"), "10")
+	s.failPut = ""
+	s.fails(codeNotFound, "queryWallet", addressOf("carol"))
+	s.expectSupply("100")
+}
+
+func TestCreateWalletRejectsNonNumericBalance(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := addressOf("alice")
+
+	expectMessage(t, s.fails(codeBadRequest, "initWallet", alice, "abc"), "2nd Argument must be a numeric string")
+	expectMessage(t, s.fails(codeBadRequest, "initWallet", alice, "12abc"), "2nd Argument must be a numeric string")
+	expectMessage(t, s.fails(codeBadRequest, "initWallet", alice, "-1"), "2nd Argument can't be negative")
+
+	//None of them left a wallet behind, not even one with a zero balance
+	s.fails(codeNotFound, "queryWallet", alice)
+	s.expectSupply("0")
+}
+
+func TestCreateWalletRejectsEmptyArguments(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := addressOf("alice")
+
+	expectMessage(t, s.fails(codeBadRequest, "initWallet", "", "100"), "1st Argument can't be empty")
+	expectMessage(t, s.fails(codeBadRequest, "initWallet", alice, ""), "2nd Argument can't be empty")
+	s.fails(codeNotFound, "queryWallet", alice)
+}
+
+func TestDeleteWalletRemovesIndexEntries(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	s.createWallet("bob", "50")
+
+	balanceKey := s.compositeKey(addressBalanceIndex, alice, "100")
+	ownerKey := s.compositeKey(ownerIDIndex, s.idOf("admin"), alice)
+	if s.State[balanceKey] == nil || s.State[ownerKey] == nil {
+		t.Fatal("the wallet wasn't indexed")
+	}
+
+	s.as("bob").fails(codeForbidden, "deleteWallet", alice)
+	s.ok("deleteWallet", alice)
+	s.fails(codeNotFound, "queryWallet", alice)
+	s.fails(codeNotFound, "deleteWallet", alice)
+	if s.State[balanceKey] != nil || s.State[ownerKey] != nil {
+		t.Fatal("deleting the wallet left its index entries behind")
+	}
+	s.expectSupply("50")
+}
+
+func TestDeletingAWalletClearsItsRecords(t *testing.T) {
+	deletions := map[string]func(s *testStub, alice, bob string){
+		"deleteWallet": func(s *testStub, alice, bob string) { s.ok("deleteWallet", alice) },
+		"closeWallet": func(s *testStub, alice, bob string) {
+			s.ok("transferFunds", alice, bob, "90")
+			s.ok("closeWallet", alice)
+		},
+		"adminTransfer": func(s *testStub, alice, bob string) { s.ok("adminTransfer", alice, bob, "true") },
+	}
+	for name, remove := range deletions {
+		t.Run(name, func(t *testing.T) {
+			s := newTestStub(t)
+			s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+			alice := s.createWallet("alice", "100")
+			bob := s.createWallet("bob", "0")
+			s.ok("setDailyLimit", alice, "500")
+			s.ok("transferFunds", alice, bob, "10")
+			s.ok("approve", alice, s.idOf("bob"), "50")
+
+			remove(s, alice, bob)
+			for _, index := range []string{changeLogIndex, dailyLimitIndex, dailySentIndex, allowanceIndex} {
+				if left := s.scan(s.compositeKey(index, alice), s.compositeKey(index, alice)+string(rune(0x10FFFF))); len(left) != 0 {
+					t.Fatalf("%d %s records left after %s", len(left), index, name)
+				}
+			}
+
+			//A wallet recreated at the same address starts from scratch
+			s.createWallet("alice", "100")
+			s.as("bob").fails(codeInsufficientFunds, "transferFrom", s.idOf("bob"), alice, bob, "10")
+			log := struct {
+				Total int `json:"total"`
+			}{}
+			decode(t, s.ok("getWalletChangeLog", alice).Data, &log)
+			if log.Total != 1 {
+				t.Fatalf("recreated wallet has %d change log entries instead of 1", log.Total)
+			}
+		})
+	}
+}
+
+func TestOwnerAuth(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY", EnforceOwnerAuth: true})
+	alice := s.createWallet("alice", "100", "", s.idOf("alice"))
+	bob := s.createWallet("bob", "0", "", s.idOf("bob"))
+
+	expectMessage(t, s.as("bob").fails(codeForbidden, "transferFunds", alice, bob, "10"), "caller is not the wallet owner")
+	s.as("alice").ok("transferFunds", alice, bob, "10")
+	s.expectBalance(alice, "90")
+	s.expectBalance(bob, "10")
+}
+
+func TestGetBalance(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "1234")
+
+	balance := struct {
+		Balance  string `json:"balance"`
+		Held     string `json:"held"`
+		Reserved string `json:"reserved"`
+	}{}
+	decode(t, s.ok("getBalance", alice).Data, &balance)
+	if balance.Balance != "1234" || balance.Held != "0" || balance.Reserved != "0" {
+		t.Fatalf("unexpected balance %+v", balance)
+	}
+	expectMessage(t, s.fails(codeNotFound, "getBalance", addressOf("nobody")), "Wallet does not exist: "+addressOf("nobody"))
+}
+
+func TestOwnerAuthIsOptional(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	carol := s.createWallet("carol", "100", "", s.idOf("carol"))
+	dave := s.createWallet("dave", "0")
+
+	//Without the flag, any identity can move the money, like before
+	s.as("bob").ok("transferFunds", carol, dave, "10")
+	s.expectBalance(dave, "10")
+}
+
+func TestFees(t *testing.T) {
+	treasury := addressOf("treasury")
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY", Treasury: treasury, FeeFlat: "1", FeeBasisPoints: 100})
+	s.createWallet("treasury", "0")
+	alice := s.createWallet("alice", "1000")
+	bob := s.createWallet("bob", "0")
+
+	receipt := TransferReceipt{}
+	decode(t, s.ok("transferFunds", alice, bob, "100").Data, &receipt)
+	if receipt.Fee != "2" {
+		t.Fatalf("fee is %s, expected 1%% plus 1", receipt.Fee)
+	}
+	s.expectBalance(alice, "898")
+	s.expectBalance(bob, "100")
+	s.expectBalance(treasury, "2")
+	s.expectSupply("1000")
+
+	//The fee has to be covered on top of the amount
+	s.fails(codeInsufficientFunds, "transferFunds", bob, alice, "100")
+	s.expectBalance(bob, "100")
+}
+
+func TestConfigAmountsUseDecimals(t *testing.T) {
+	treasury := addressOf("treasury")
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY", Decimals: 2, Treasury: treasury, FeeFlat: "0.05", MaxInitialBalance: "100.00", ReasonRequiredThreshold: "50.50"})
+	s.createWallet("treasury", "0")
+	alice := s.createWallet("alice", "100.00")
+	bob := s.createWallet("bob", "0")
+	s.fails(codeBadRequest, "initWallet", addressOf("carol"), "100.01")
+
+	receipt := TransferReceipt{}
+	decode(t, s.ok("transferFunds", alice, bob, "50.50").Data, &receipt)
+	if receipt.Fee != "0.05" || receipt.FromBalance != "49.45" {
+		t.Fatalf("unexpected receipt %+v", receipt)
+	}
+	expectMessage(t, s.fails(codeBadRequest, "transferFunds", bob, alice, "50.51"), "Transfers above 50.50 require a memo")
+
+	for _, config := range []string{"{\"decimals\":2,\"feeFlat\":\"-1\"}", "{\"decimals\":2,\"feeFlat\":\"0.001\"}", "{\"decimals\":2,\"maxInitialBalance\":\"lots\"}", "{\"decimals\":2,\"reasonRequiredThreshold\":\"-5\"}"} {
+		if response := decodeResponse(t, s.init("admin", config)); response.Status != codeBadRequest {
+			t.Fatalf("config %s was accepted: %+v", config, response)
+		}
+	}
+}
+
+func TestUpdateOwner(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100", "", "alice")
+
+	s.ok("updateOwner", alice, "carol")
+	if owner := s.wallet(alice).Owner; owner != "carol" {
+		t.Fatalf("owner is %q after the update", owner)
+	}
+	records := []queryRecord{}
+	decode(t, s.ok("queryWalletsByOwner", "carol").Data, &records)
+	expectKeys(t, recordKeys(records), alice)
+	decode(t, s.ok("queryWalletsByOwner", "alice").Data, &records)
+	expectKeys(t, recordKeys(records))
+
+	expectMessage(t, s.fails(codeBadRequest, "updateOwner", alice, ""), "2nd Argument can't be empty")
+	if owner := s.wallet(alice).Owner; owner != "carol" {
+		t.Fatalf("owner is %q after a rejected update", owner)
+	}
+}
+
+func TestUpdateOwnerWithOwnerAuth(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY", EnforceOwnerAuth: true})
+	alice := s.createWallet("alice", "100", "", s.idOf("alice"))
+
+	expectMessage(t, s.as("bob").fails(codeForbidden, "updateOwner", alice, s.idOf("bob")), "caller is not the wallet owner")
+	s.as("alice").ok("updateOwner", alice, s.idOf("carol"))
+
+	//The admin can reassign a wallet it doesn't own, e.g. when its owner lost their key
+	s.ok("updateOwner", alice, s.idOf("dave"))
+	if owner := s.wallet(alice).Owner; owner != s.idOf("dave") {
+		t.Fatalf("owner is %q after the admin's update", owner)
+	}
+}
+
+func TestTransferToMissingWallet(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	nobody := addressOf("nobody")
+
+	expectMessage(t, s.fails(codeNotFound, "transferFunds", alice, nobody, "10"), "Wallet does not exist: "+nobody)
+	expectMessage(t, s.fails(codeNotFound, "transferFunds", nobody, alice, "10"), "Wallet does not exist: "+nobody)
+	s.expectBalance(alice, "100")
+}
+
+func TestMaxInitialBalance(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY", MaxInitialBalance: "1000"})
+
+	s.createWallet("under", "999")
+	s.createWallet("at", "1000")
+	expectMessage(t, s.fails(codeBadRequest, "initWallet", addressOf("over"), "1001"), "initial balance exceeds configured cap")
+	s.expectSupply("1999")
+}
+
+func TestTimestamps(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "0")
+
+	created := s.wallet(alice)
+	createdAt, err := time.Parse(time.RFC3339, created.CreatedAt)
+	if err != nil || created.UpdatedAt != created.CreatedAt {
+		t.Fatalf("unexpected timestamps %q, %q", created.CreatedAt, created.UpdatedAt)
+	}
+
+	s.ok("transferFunds", alice, bob, "10")
+	transferred := s.wallet(alice)
+	updatedAt, err := time.Parse(time.RFC3339, transferred.UpdatedAt)
+	if err != nil || !updatedAt.After(createdAt) || transferred.CreatedAt != created.CreatedAt {
+		t.Fatalf("updatedAt didn't advance: %q, %q", transferred.CreatedAt, transferred.UpdatedAt)
+	}
+	if !updatedAt.Equal(s.now.Truncate(time.Second)) {
+		t.Fatalf("updatedAt %s isn't the time of the transaction %s", updatedAt, s.now)
+	}
+}
+
+func TestCreateWalletRequestID(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := addressOf("alice")
+
+	first := s.ok("initWallet", alice, "100", "", "", "req-1")
+	replay := s.ok("initWallet", alice, "100", "", "", "req-1")
+	if string(first.Data) != string(replay.Data) {
+		t.Fatalf("replay answered %s instead of %s", replay.Data, first.Data)
+	}
+	s.expectSupply("100")
+
+	expectMessage(t, s.fails(codeConflict, "initWallet", addressOf("bob"), "100", "", "", "req-1"), "request id req-1 was already used for wallet "+alice)
+	s.fails(codeNotFound, "queryWallet", addressOf("bob"))
+}
+
+func TestCurrencies(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY", BaseCurrency: "USD"})
+	euro1 := s.createWallet("euro1", "100", "EUR")
+	euro2 := s.createWallet("euro2", "0", "EUR")
+	dollar := s.createWallet("dollar", "0")
+
+	if currency := s.wallet(dollar).Currency; currency != "USD" {
+		t.Fatalf("wallet created without a currency holds %q", currency)
+	}
+	s.ok("transferFunds", euro1, euro2, "10")
+	expectMessage(t, s.fails(codeBadRequest, "transferFunds", euro1, dollar, "10"), "currency mismatch")
+	s.expectBalance(euro1, "90")
+	s.expectBalance(dollar, "0")
+}
+
+func TestInitMetadata(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY", Decimals: 2})
+
+	token := TokenInfo{}
+	decode(t, s.ok("getTokenInfo").Data, &token)
+	if token.Name != "Halley Coin" || token.Symbol != "HLY" || token.Decimals != 2 {
+		t.Fatalf("unexpected token %+v", token)
+	}
+
+	for _, config := range []string{"{\"name\":\"Halley Coin\"}", "{\"symbol\":\"HLY\"}", "{}", "not json", "{\"name\":\"Halley Coin\",\"symbol\":\"HLY\",\"decimals\":19}"} {
+		bare := newTestStub(t)
+		if response := decodeResponse(t, bare.init("admin", config)); response.Status != codeBadRequest {
+			t.Fatalf("Init accepted %s", config)
+		}
+	}
+}
+
+func TestInitUpgrade(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY", Decimals: 2, FeeFlat: "0.01"})
+	alice := s.createWallet("alice", "1.00")
+
+	//An upgrade without a config keeps everything as it was
+	if response := s.init("bob"); response.Status != shim.OK {
+		t.Fatalf("upgrade without a config failed: %s", response.Message)
+	}
+	config, _ := getConfig(s)
+	if config.Admin != s.idOf("admin") || config.FeeFlat != "0.01" || config.Decimals != 2 {
+		t.Fatalf("upgrade changed the config %+v", config)
+	}
+
+	if response := decodeResponse(t, s.init("bob", "{\"name\":\"Halley Coin\",\"symbol\":\"HLY\",\"decimals\":2}")); response.Status != codeForbidden {
+		t.Fatalf("a non-admin replaced the config: %+v", response)
+	}
+	if response := decodeResponse(t, s.init("admin", "{\"decimals\":0}")); response.Status != codeConflict {
+		t.Fatalf("decimals changed while wallets exist: %+v", response)
+	}
+
+	//The admin can change the policies, the token carries over when it isn't restated
+	if response := s.init("admin", "{\"decimals\":2,\"feeFlat\":\"0.05\"}"); response.Status != shim.OK {
+		t.Fatalf("admin upgrade failed: %s", response.Message)
+	}
+	config, _ = getConfig(s)
+	if config.FeeFlat != "0.05" || config.Name != "Halley Coin" || config.Symbol != "HLY" {
+		t.Fatalf("unexpected config after the upgrade %+v", config)
+	}
+	s.expectBalance(alice, "100")
+}
+
+func TestTransferFundsWithMemo(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "0")
+
+	response := s.ok("transferFundsWithMemo", alice, bob, "5", "invoice 43")
+	receipt := TransferReceipt{}
+	decode(t, s.ok("getReceipt", response.TxID).Data, &receipt)
+	if receipt.Memo != "invoice 43" || receipt.Amount != "5" {
+		t.Fatalf("unexpected receipt %+v", receipt)
+	}
+
+	//The note is what this variant is for, so it can't be left out
+	s.fails(codeBadRequest, "transferFundsWithMemo", alice, bob, "5", " ")
+	s.fails(codeBadRequest, "transferFundsWithMemo", alice, bob, "5")
+	s.expectBalance(bob, "5")
+}
+
+func TestAdminOnlyActions(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+
+	expectMessage(t, s.as("bob").fails(codeForbidden, "setKYCStatus", alice, "true"), "Only the admin can set the KYC status of a Wallet")
+	s.ok("setKYCStatus", alice, "true")
+	if !s.wallet(alice).KYCVerified {
+		t.Fatal("wallet isn't KYC-verified")
+	}
+
+	s.as("bob").fails(codeForbidden, "transferAdmin", s.idOf("bob"))
+	s.ok("transferAdmin", s.idOf("bob"))
+	s.fails(codeForbidden, "setKYCStatus", alice, "false")
+	s.as("bob").ok("setKYCStatus", alice, "false")
+	s.as("bob").ok("mint", alice, "1")
+}
+
+func TestCloseWallet(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "10")
+	bob := s.createWallet("bob", "0")
+
+	expectMessage(t, s.fails(codeConflict, "closeWallet", alice), "still holds 10")
+	s.ok("closeWallet", bob)
+	event := WalletClosedEvent{}
+	s.expectEvent("WalletClosedEvent", &event)
+	if event.Address != bob || event.TxID == "" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+
+	s.fails(codeNotFound, "queryWallet", bob)
+	if s.State[s.compositeKey(addressBalanceIndex, bob, "0")] != nil || s.State[s.compositeKey(ownerIDIndex, s.idOf("admin"), bob)] != nil {
+		t.Fatal("closing the wallet left its index entries behind")
+	}
+	if count := string(s.ok("getWalletCount").Data); count != "1" {
+		t.Fatalf("wallet count is %s", count)
+	}
+	s.expectSupply("10")
+}
+
+func TestAdminTransfer(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "40")
+	treasury := s.createWallet("treasury", "0")
+
+	s.as("bob").fails(codeForbidden, "adminTransfer", alice, treasury)
+	receipt := TransferReceipt{}
+	decode(t, s.ok("adminTransfer", alice, treasury).Data, &receipt)
+	if receipt.Amount != "100" || receipt.ToBalance != "100" {
+		t.Fatalf("unexpected receipt %+v", receipt)
+	}
+	s.expectBalance(alice, "0")
+	s.expectBalance(treasury, "100")
+
+	s.ok("adminTransfer", bob, treasury, "true")
+	s.fails(codeNotFound, "queryWallet", bob)
+	s.expectBalance(treasury, "140")
+	s.expectSupply("140")
+	if count := string(s.ok("getWalletCount").Data); count != "2" {
+		t.Fatalf("wallet count is %s", count)
+	}
+}
+
+func TestCorruptState(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "100")
+	s.tamper(alice, []byte("{not json"))
+
+	for _, function := range []string{"queryWallet", "getBalance", "queryWalletRaw"} {
+		expectMessage(t, s.fails(codeInternal, function, alice), "wallet "+alice+" state is corrupt: ")
+	}
+	expectMessage(t, s.fails(codeInternal, "transferFunds", alice, bob, "1"), "wallet "+alice+" state is corrupt: ")
+
+	s.tamper(bob, []byte("{\"address\":\""+bob+"\",\"balance\":\"ten\"}"))
+	expectMessage(t, s.fails(codeInternal, "queryWallet", bob), "wallet "+bob+" state is corrupt: balance ten is not a whole number")
+}
+
+func TestQueryWalletRaw(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+
+	peerResponse := s.run("admin", false, []string{"queryWalletRaw", alice})
+	if peerResponse.Status != shim.OK {
+		t.Fatalf("queryWalletRaw failed: %s", peerResponse.Message)
+	}
+	wallet := Wallet{}
+	decode(t, peerResponse.Payload, &wallet)
+	if wallet.Address != alice || wallet.Balance.String() != "100" {
+		t.Fatalf("unexpected wallet %+v", wallet)
+	}
+	s.fails(codeNotFound, "queryWalletRaw", addressOf("nobody"))
+}
+
+func TestAddressMustBeMD5(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+
+	expectMessage(t, s.fails(codeBadRequest, "initWallet", strings.ToUpper(addressOf("carol")), "1"), "lowercase hex")
+	expectMessage(t, s.fails(codeBadRequest, "initWallet", "abc123", "1"), "md5 hash of 32 characters, got 6")
+	expectMessage(t, s.fails(codeBadRequest, "initWallet", strings.Repeat("g", addressLength), "1"), "lowercase hex")
+	s.createWallet("carol", "1")
+}
+
+func TestCreateWalletAuto(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+
+	created := func(owner string) string {
+		response := s.ok("createWalletAuto", owner, "10")
+		result := struct {
+			Address string `json:"address"`
+		}{}
+		decode(t, response.Data, &result)
+		if result.Address != fmt.Sprintf("%x", md5.Sum([]byte(owner+"\x00"+response.TxID))) {
+			t.Fatalf("address %s isn't derived from the owner and the txid", result.Address)
+		}
+		if s.wallet(result.Address).Owner != owner {
+			t.Fatalf("wallet %s isn't owned by %s", result.Address, owner)
+		}
+		return result.Address
+	}
+
+	alice := created("alice")
+	bob := created("bob")
+	again := created("alice")
+	if alice == bob || alice == again {
+		t.Fatalf("wallets share ids: %s, %s, %s", alice, bob, again)
+	}
+	s.expectSupply("30")
+}
+
+func TestTransferPercent(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "200")
+	bob := s.createWallet("bob", "0")
+
+	s.ok("transferPercent", alice, bob, "50")
+	s.expectBalance(alice, "100")
+	s.ok("transferPercent", alice, bob, "100")
+	s.expectBalance(alice, "0")
+	s.expectBalance(bob, "200")
+
+	for _, percent := range []string{"0", "150", "-5", "half"} {
+		s.fails(codeBadRequest, "transferPercent", bob, alice, percent)
+	}
+	s.expectBalance(bob, "200")
+}
+
+func TestValidateAddress(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+
+	s.createWallet("alice", "1")
+	for _, address := range []string{
+		addressOf("alice") + "0",
+		addressOf("bob")[:31] + "\x00",
+		"\x00config\x00",
+		"alice/../bob",
+	} {
+		s.fails(codeBadRequest, "initWallet", address, "1")
+	}
+	if count, _ := readWalletCount(s); count != 1 {
+		t.Fatalf("wallet count is %d, expected 1", count)
+	}
+}
+
+func TestTxIDInResponses(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "0")
+
+	for _, call := range [][]string{
+		{"initWallet", addressOf("carol"), "1"},
+		{"transferFunds", alice, bob, "1"},
+		{"queryWallet", alice},
+	} {
+		response := s.ok(call[0], call[1:]...)
+		if expected := fmt.Sprintf("tx%04d", s.txCount); response.TxID != expected {
+			t.Fatalf("%s answered with txid %q instead of %q", call[0], response.TxID, expected)
+		}
+	}
+}
+
+func TestHandlersDispatch(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	aliases := map[string]string{
+		"createWallet":   "initWallet",
+		"queryWallet":    "readWallet",
+		"mintFunds":      "mint",
+		"burnFunds":      "burn",
+		"getTransaction": "getReceipt",
+		"holdFunds":      "placeHold",
+	}
+
+	//Too many arguments for any handler, so each one answers with its own name
+	args := strings.Split(strings.Repeat("x,", 11)+"x", ",")
+	for function := range s.cc.handlers() {
+		name := function
+		if alias, ok := aliases[function]; ok {
+			name = alias
+		}
+		response := s.fails(codeBadRequest, function, args...)
+		expectMessage(t, response, name+": Incorrect number of arguments")
+	}
+
+	expectMessage(t, s.fails(codeBadRequest, "doesNotExist"), "Received Unknown function invocation")
+}
+
+func TestDeleteAllWallets(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "50")
+	s.createWallet("carol", "0")
+	s.ok("setDailyLimit", alice, "500")
+	s.ok("transferFunds", alice, bob, "10")
+	s.ok("approve", alice, s.idOf("bob"), "5")
+
+	s.fails(codeBadRequest, "deleteAllWallets", "yes")
+	s.as("bob").fails(codeForbidden, "deleteAllWallets", deleteAllConfirmation)
+
+	deleted := struct {
+		Deleted int `json:"deleted"`
+	}{}
+	decode(t, s.ok("deleteAllWallets", deleteAllConfirmation).Data, &deleted)
+	if deleted.Deleted != 3 {
+		t.Fatalf("deleted %d wallets instead of 3", deleted.Deleted)
+	}
+
+	records := []queryRecord{}
+	decode(t, s.ok("getWalletsByRange", "", "").Data, &records)
+	if len(records) != 0 {
+		t.Fatalf("wallets left after deleting all of them: %v", recordKeys(records))
+	}
+	for _, index := range []string{addressBalanceIndex, ownerIDIndex, changeLogIndex, dailyLimitIndex, dailySentIndex, allowanceIndex} {
+		if left := s.scan(s.compositeKey(index), s.compositeKey(index)+string(rune(0x10FFFF))); len(left) != 0 {
+			t.Fatalf("%d %s records left after deleting every wallet", len(left), index)
+		}
+	}
+	if count := string(s.ok("getWalletCount").Data); count != "0" {
+		t.Fatalf("wallet count is %s", count)
+	}
+	s.expectSupply("0")
+	if _, err := getConfig(s); err != nil {
+		t.Fatalf("config didn't survive: %s", err)
+	}
+}
+
+func TestDeleteAllWalletsClearsReplayRecords(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := addressOf("alice")
+	s.ok("initWallet", alice, "100", "", "", "req-1")
+	bob := s.createWallet("bob", "0")
+	s.ok("transferFundsIdempotent", alice, bob, "10", "key-1")
+
+	s.ok("deleteAllWallets", deleteAllConfirmation)
+	for _, index := range []string{requestIndex, idempotencyIndex} {
+		if left := s.scan(s.compositeKey(index), s.compositeKey(index)+string(rune(0x10FFFF))); len(left) != 0 {
+			t.Fatalf("%d %s records left after deleting every wallet", len(left), index)
+		}
+	}
+
+	//The same request id now creates the wallet again instead of answering for the wiped one
+	s.ok("initWallet", alice, "100", "", "", "req-1")
+	s.expectBalance(alice, "100")
+	s.createWallet("bob", "0")
+	s.ok("transferFundsIdempotent", alice, bob, "10", "key-1")
+	s.expectBalance(alice, "90")
+	s.expectSupply("100")
+}
+
+func TestDeleteAllWalletsRefusesReservedMoney(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "0")
+	s.ok("createEscrow", alice, bob, "10")
+
+	expectMessage(t, s.fails(codeConflict, "deleteAllWallets", deleteAllConfirmation), "reserved by open escrows or time locks")
+	s.expectBalance(alice, "90")
+}
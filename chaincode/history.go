@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+* Define the HistoryEntry Structure, it's the state of a wallet after one transaction
+* [TxID] <-- Transaction that wrote the wallet
+* [Timestamp] <-- RFC3339 timestamp of the transaction
+* [Value] <-- Wallet as it was after the transaction, null when it was deleted
+* [IsDelete] <-- Flag that indicates the transaction deleted the wallet
+ */
+type HistoryEntry struct {
+	TxID      string          `json:"txId"`
+	Timestamp string          `json:"timestamp"`
+	Value     json.RawMessage `json:"value"`
+	IsDelete  bool            `json:"isDelete"`
+}
+
+/*
+* getWalletHistory
+* This method returns every value a wallet has had on the ledger, oldest first
+* [id]		= This is the id for the wallet
+* (JSON)	= JSON Array with the history of the wallet
+ */
+
+func (t *SimpleChaincode) getWalletHistory(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("getWalletHistory", args, 1); err != nil {
+		return errorFromErr(err)
+	}
+
+	address := args[0]
+	resultsIterator, err := stub.GetHistoryForKey(address)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	defer resultsIterator.Close()
+
+	history := []HistoryEntry{}
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+		if err != nil {
+			return errorFromErr(err)
+		}
+
+		entry := HistoryEntry{TxID: modification.TxId, IsDelete: modification.IsDelete}
+		if modification.Timestamp != nil {
+			entry.Timestamp = time.Unix(modification.Timestamp.Seconds, int64(modification.Timestamp.Nanos)).UTC().Format(time.RFC3339)
+		}
+		//Deletes carry no value, so they're reported as null
+		if !modification.IsDelete && len(modification.Value) > 0 {
+			_, err = unmarshalWallet(address, modification.Value)
+			if err != nil {
+				return errorFromErr(err)
+			}
+			entry.Value = json.RawMessage(modification.Value)
+		}
+		history = append(history, entry)
+	}
+
+	historyAsBytes, err := json.Marshal(history)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Printf("- getWalletHistory returning:\n%s\n", string(historyAsBytes))
+	return successJSON(stub, historyAsBytes)
+}
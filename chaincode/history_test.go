@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestWalletHistory(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "0")
+	s.fails(codeInsufficientFunds, "transferFunds", alice, bob, "500")
+	s.ok("transferFunds", alice, bob, "30")
+	s.ok("deleteWallet", alice)
+
+	history := []HistoryEntry{}
+	decode(t, s.ok("getWalletHistory", alice).Data, &history)
+	if len(history) != 3 {
+		t.Fatalf("history has %d entries instead of 3", len(history))
+	}
+	first := Wallet{}
+	second := Wallet{}
+	decode(t, history[0].Value, &first)
+	decode(t, history[1].Value, &second)
+	if first.Balance.String() != "100" || second.Balance.String() != "70" || !history[2].IsDelete || string(history[2].Value) != "null" {
+		t.Fatalf("unexpected history %+v", history)
+	}
+	if !(history[0].TxID < history[1].TxID && history[1].TxID < history[2].TxID) || history[0].Timestamp == "" {
+		t.Fatalf("history isn't in transaction order %+v", history)
+	}
+}
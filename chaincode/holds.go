@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+* placeHold
+* This method moves money from the balance of a wallet to its held balance, where transfers and burns can't reach it
+* Placing a hold follows the same owner rule as a transfer, the admin can always place one
+* It's also routed as holdFunds
+* [id]		= This is the id for the wallet whose money is held
+* [amount]	= This is the amount of money being held
+ */
+
+func (t *SimpleChaincode) placeHold(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//		 0			1
+	//	  Address	  Amount
+
+	if err := requireArgs("placeHold", args, 2); err != nil {
+		return errorFromErr(err)
+	}
+
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	amount, err := parseAmount(args[1], config.Decimals)
+	if err != nil {
+		return errorJSON(codeBadRequest, "Failed to parse into Integer, 2nd Argument must be a numeric string: "+err.Error())
+	}
+	if amount.Sign() <= 0 {
+		return errorJSON(codeBadRequest, "hold amount must be positive")
+	}
+
+	wallet, err := getWallet(stub, args[0])
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if wallet.Frozen {
+		return errorJSON(codeLocked, "wallet is frozen: "+wallet.Address)
+	}
+
+	callerID, err := getCallerID(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	admin := config.Admin != "" && callerID == config.Admin
+	if config.EnforceOwnerAuth && callerID != wallet.Owner && !admin {
+		return errorJSON(codeForbidden, "caller is not the wallet owner")
+	}
+
+	if wallet.Balance.Cmp(amount) < 0 {
+		return errorJSON(codeInsufficientFunds, "Insufficient funds to place the hold")
+	}
+
+	oldBalance := wallet.Balance
+	wallet.Balance = new(big.Int).Sub(wallet.Balance, amount)
+	wallet.Held = new(big.Int).Add(wallet.Held, amount)
+	err = saveWallet(stub, oldBalance, wallet, "placeHold")
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Println(" - END placeHold - ")
+	return successJSON(stub, nil)
+}
+
+/*
+* releaseHold
+* This method gives held money back to the balance of its wallet, only the admin can call it
+* [id]		= This is the id for the wallet whose money is released
+* [amount]	= This is the amount of money being released
+ */
+
+func (t *SimpleChaincode) releaseHold(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return t.releaseHeld(stub, args, "releaseHold", false)
+}
+
+/*
+* releaseFunds
+* This method gives held money back to the balance of its wallet, the owner of the wallet or the admin can call it
+* [id]		= This is the id for the wallet whose money is released
+* [amount]	= This is the amount of money being released
+ */
+
+func (t *SimpleChaincode) releaseFunds(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return t.releaseHeld(stub, args, "releaseFunds", true)
+}
+
+/*
+* releaseHeld
+* This method backs both releaseHold and releaseFunds, only the latter lets the owner release their own money
+ */
+
+func (t *SimpleChaincode) releaseHeld(stub shim.ChaincodeStubInterface, args []string, op string, ownerMayRelease bool) pb.Response {
+	//		 0			1
+	//	  Address	  Amount
+
+	if err := requireArgs(op, args, 2); err != nil {
+		return errorFromErr(err)
+	}
+
+	wallet, amount, err := loadHold(stub, args[0], args[1], ownerMayRelease)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	oldBalance := wallet.Balance
+	wallet.Balance = new(big.Int).Add(wallet.Balance, amount)
+	wallet.Held = new(big.Int).Sub(wallet.Held, amount)
+	err = saveWallet(stub, oldBalance, wallet, op)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Println(" - END " + op + " - ")
+	return successJSON(stub, nil)
+}
+
+/*
+* settleHold
+* This method pays held money out to another wallet, only the admin can call it
+* Settlements are the outcome of a hold, so they're charged no fee
+* [id]		= This is the id for the wallet whose held money is paid out
+* [to]		= This is the id for the wallet receiving the money
+* [amount]	= This is the amount of held money being paid
+* (JSON)	= JSON Document with the receipt of the settlement
+ */
+
+func (t *SimpleChaincode) settleHold(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//		 0			1		2
+	//	  Address		to	  Amount
+
+	if err := requireArgs("settleHold", args, 3); err != nil {
+		return errorFromErr(err)
+	}
+
+	from := args[0]
+	to := args[1]
+	if from == to {
+		return errorJSON(codeBadRequest, "cannot transfer to the same wallet")
+	}
+
+	walletFrom, amount, err := loadHold(stub, from, args[2], false)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	walletTo, err := getWallet(stub, to)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if walletFrom.Frozen {
+		return errorJSON(codeLocked, "wallet is frozen: "+from)
+	}
+	if walletTo.Frozen {
+		return errorJSON(codeLocked, "wallet is frozen: "+to)
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if walletCurrency(config, &walletFrom) != walletCurrency(config, &walletTo) {
+		return errorJSON(codeBadRequest, "currency mismatch")
+	}
+
+	//The held money already left the balance of the sender, so only the receiver's balance moves
+	walletFrom.Held = new(big.Int).Sub(walletFrom.Held, amount)
+	oldBalance := walletTo.Balance
+	walletTo.Balance = new(big.Int).Add(walletTo.Balance, amount)
+
+	err = saveWallet(stub, walletFrom.Balance, walletFrom, "settleHold")
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = saveWallet(stub, oldBalance, walletTo, "settleHold")
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	receipt := TransferReceipt{
+		TransferEvent: TransferEvent{From: from, To: to, Amount: formatAmount(amount, config.Decimals), Memo: "settleHold", TxID: stub.GetTxID()},
+		Fee:           formatAmount(new(big.Int), config.Decimals),
+		FromBalance:   formatAmount(walletFrom.Balance, config.Decimals),
+		ToBalance:     formatAmount(walletTo.Balance, config.Decimals),
+	}
+	receiptAsBytes, err := recordTransfer(stub, receipt)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Println(" - END settleHold - ")
+	return successJSON(stub, receiptAsBytes)
+}
+
+/*
+* loadHold
+* This method checks the caller is releasing or settling money a wallet really has on hold
+* Only the admin can, unless ownerMayRelease lets the owner of the wallet release it too
+ */
+
+func loadHold(stub shim.ChaincodeStubInterface, address string, value string, ownerMayRelease bool) (Wallet, *big.Int, error) {
+	config, err := getConfig(stub)
+	if err != nil {
+		return Wallet{}, nil, err
+	}
+	callerID, err := getCallerID(stub)
+	if err != nil {
+		return Wallet{}, nil, err
+	}
+	admin := config.Admin != "" && callerID == config.Admin
+
+	amount, err := parseAmount(value, config.Decimals)
+	if err != nil {
+		return Wallet{}, nil, newError(codeBadRequest, "Failed to parse the amount: %s", err.Error())
+	}
+	if amount.Sign() <= 0 {
+		return Wallet{}, nil, newError(codeBadRequest, "hold amount must be positive")
+	}
+
+	wallet, err := getWallet(stub, address)
+	if err != nil {
+		return Wallet{}, nil, err
+	}
+	if ownerMayRelease && !admin && callerID != wallet.Owner {
+		return Wallet{}, nil, newError(codeForbidden, "Only the wallet owner or the admin can release a hold")
+	} else if !ownerMayRelease && !admin {
+		return Wallet{}, nil, newError(codeForbidden, "Only the admin can release or settle a hold")
+	}
+	if wallet.Held.Cmp(amount) < 0 {
+		return Wallet{}, nil, newError(codeInsufficientFunds, "wallet %s only has %s on hold", address, formatAmount(wallet.Held, config.Decimals))
+	}
+	return wallet, amount, nil
+}
+
+/*
+* saveWallet
+* This method saves a wallet whose balance moved, keeping its index and change log in line
+ */
+
+func saveWallet(stub shim.ChaincodeStubInterface, oldBalance *big.Int, wallet Wallet, op string) error {
+	err := putWallet(stub, wallet)
+	if err != nil {
+		return err
+	}
+	err = reindexWallet(stub, oldBalance, wallet)
+	if err != nil {
+		return err
+	}
+	return appendChangeLog(stub, wallet.Address, op, new(big.Int).Sub(wallet.Balance, oldBalance))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestHolds(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100", "", s.idOf("alice"))
+	bob := s.createWallet("bob", "0")
+
+	s.ok("placeHold", alice, "60")
+	wallet := s.wallet(alice)
+	if wallet.Balance.String() != "40" || wallet.Held.String() != "60" {
+		t.Fatalf("hold left %s and %s on hold", wallet.Balance, wallet.Held)
+	}
+
+	s.as("alice").fails(codeForbidden, "releaseHold", alice, "20")
+	s.ok("releaseHold", alice, "20")
+	s.expectBalance(alice, "60")
+
+	receipt := TransferReceipt{}
+	s.as("alice").fails(codeForbidden, "settleHold", alice, bob, "40")
+	decode(t, s.ok("settleHold", alice, bob, "40").Data, &receipt)
+	if receipt.Amount != "40" || receipt.ToBalance != "40" {
+		t.Fatalf("unexpected settlement %+v", receipt)
+	}
+	expectMessage(t, s.fails(codeInsufficientFunds, "releaseHold", alice, "1"), "only has 0 on hold")
+
+	wallet = s.wallet(alice)
+	if wallet.Balance.String() != "60" || wallet.Held.Sign() != 0 {
+		t.Fatalf("wallet left with %s and %s on hold", wallet.Balance, wallet.Held)
+	}
+	s.expectBalance(bob, "40")
+	s.expectSupply("100")
+}
+
+func TestHeldFundsCantBeSpent(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100", "", s.idOf("alice"))
+	bob := s.createWallet("bob", "0")
+
+	s.as("alice").ok("holdFunds", alice, "60")
+
+	//Held money can't be spent, only what's left
+	s.fails(codeInsufficientFunds, "transferFunds", alice, bob, "50")
+	s.fails(codeInsufficientFunds, "placeHold", alice, "41")
+	s.fails(codeInsufficientFunds, "burn", alice, "41")
+	s.expectBalance(alice, "40")
+
+	balance := struct {
+		Balance string `json:"balance"`
+		Held    string `json:"held"`
+	}{}
+	decode(t, s.ok("getBalance", alice).Data, &balance)
+	if balance.Balance != "40" || balance.Held != "60" {
+		t.Fatalf("unexpected balance %+v", balance)
+	}
+
+	//The owner can release their own hold, but nobody else besides the admin
+	s.as("bob").fails(codeForbidden, "releaseFunds", alice, "20")
+	s.as("alice").ok("releaseFunds", alice, "20")
+	s.ok("transferFunds", alice, bob, "50")
+	s.expectBalance(alice, "10")
+	s.expectBalance(bob, "50")
+	s.expectSupply("100")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Version of this build of the chaincode, bump it with every release
+const chaincodeVersion = "1.1.0"
+
+/*
+* Define the ChaincodeInfo Structure, it describes the deployed build so clients can feature-detect
+* [Version] <-- Version of the chaincode build
+* [Functions] <-- Every function Invoke routes to, sorted by name
+* [RichQueries] <-- Whether the peer's state database is CouchDB, so rich queries work
+ */
+type ChaincodeInfo struct {
+	Version     string   `json:"version"`
+	Functions   []string `json:"functions"`
+	RichQueries bool     `json:"richQueries"`
+}
+
+/*
+* getInfo
+* This method describes the deployed chaincode
+* (JSON)	= JSON Document with the version, supported functions and rich query support
+ */
+
+func (t *SimpleChaincode) getInfo(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("getInfo", args, 0); err != nil {
+		return errorFromErr(err)
+	}
+
+	info := ChaincodeInfo{Version: chaincodeVersion, RichQueries: richQueriesAvailable(stub)}
+	for function := range t.handlers() {
+		info.Functions = append(info.Functions, function)
+	}
+	sort.Strings(info.Functions)
+
+	infoAsBytes, err := json.Marshal(info)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	return successJSON(stub, infoAsBytes)
+}
+
+/*
+* richQueriesAvailable
+* This method probes the state database with the smallest rich query, LevelDB refuses to run it
+ */
+
+func richQueriesAvailable(stub shim.ChaincodeStubInterface) bool {
+	resultsIterator, err := stub.GetQueryResult("{\"selector\":{\"address\":\"\"},\"limit\":1}")
+	if err != nil {
+		return false
+	}
+	resultsIterator.Close()
+	return true
+}
+
+/*
+* Define the TokenInfo Structure, it's the metadata of the token the wallets hold
+* [Name] <-- Name of the token
+* [Symbol] <-- Ticker of the token
+* [Decimals] <-- Decimal places amounts are given in
+ */
+type TokenInfo struct {
+	Name     string `json:"name"`
+	Symbol   string `json:"symbol"`
+	Decimals int    `json:"decimals"`
+}
+
+/*
+* getTokenInfo
+* This method returns the metadata of the token set when 'Halley' was instantiated
+* (JSON)	= JSON Document with the name, symbol and decimals of the token
+ */
+
+func (t *SimpleChaincode) getTokenInfo(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("getTokenInfo", args, 0); err != nil {
+		return errorFromErr(err)
+	}
+
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	tokenInfoAsBytes, err := json.Marshal(TokenInfo{Name: config.Name, Symbol: config.Symbol, Decimals: config.Decimals})
+	if err != nil {
+		return errorFromErr(err)
+	}
+	return successJSON(stub, tokenInfoAsBytes)
+}
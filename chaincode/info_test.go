@@ -0,0 +1,29 @@
+package main
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestGetInfo(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+
+	info := ChaincodeInfo{}
+	decode(t, s.ok("getInfo").Data, &info)
+	if info.Version != chaincodeVersion || info.RichQueries {
+		t.Fatalf("unexpected info %+v", info)
+	}
+	functions := []string{}
+	for function := range s.cc.handlers() {
+		functions = append(functions, function)
+	}
+	sort.Strings(functions)
+	expectKeys(t, info.Functions, functions...)
+
+	s.couchDB = true
+	decode(t, s.ok("getInfo").Data, &info)
+	if !info.RichQueries {
+		t.Fatal("getInfo doesn't see CouchDB")
+	}
+}
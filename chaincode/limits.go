@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// The daily limit of a wallet and what it sent against it are kept by address
+const dailyLimitIndex = "dailyLimit"
+const dailySentIndex = "dailySent"
+
+/*
+* Define the DailySent Structure, it's how much a wallet sent on the day of its last transfer
+* [Date] <-- UTC date of the last transfer, as 2006-01-02
+* [Sent] <-- Amount of money sent on that date
+ */
+type DailySent struct {
+	Date string   `json:"date"`
+	Sent *big.Int `json:"sent"`
+}
+
+/*
+* MarshalJSON
+* This method saves what a wallet sent on the day of its last transfer
+ */
+
+func (d DailySent) MarshalJSON() ([]byte, error) {
+	type storedDailySent DailySent
+	return json.Marshal(struct {
+		Sent string `json:"sent"`
+		storedDailySent
+	}{storedAmount(d.Sent), storedDailySent(d)})
+}
+
+/*
+* UnmarshalJSON
+* This method reads back what a wallet sent on the day of its last transfer
+ */
+
+func (d *DailySent) UnmarshalJSON(data []byte) error {
+	type storedDailySent DailySent
+	stored := struct {
+		*storedDailySent
+		Sent json.RawMessage `json:"sent"`
+	}{storedDailySent: (*storedDailySent)(d)}
+	err := json.Unmarshal(data, &stored)
+	if err != nil {
+		return err
+	}
+
+	d.Sent, err = loadStoredAmount("sent", stored.Sent)
+	return err
+}
+
+/*
+* setDailyLimit
+* This method caps how much money a wallet can send per UTC day, only the admin can call it
+* [id]		= This is the id for the wallet
+* [limit]	= This is the most money the wallet can send in a day, zero removes the limit
+ */
+
+func (t *SimpleChaincode) setDailyLimit(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//		 0			1
+	//	  Address	  Limit
+
+	if err := requireArgs("setDailyLimit", args, 2); err != nil {
+		return errorFromErr(err)
+	}
+
+	admin, err := isAdmin(stub)
+	if err != nil {
+		return errorFromErr(err)
+	} else if !admin {
+		return errorJSON(codeForbidden, "Only the admin can set the daily limit of a Wallet")
+	}
+
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	limit, err := parseAmount(args[1], config.Decimals)
+	if err != nil {
+		return errorJSON(codeBadRequest, "Failed to parse into Integer, 2nd Argument must be a numeric string: "+err.Error())
+	}
+	if limit.Sign() < 0 {
+		return errorJSON(codeBadRequest, "daily limit can't be negative")
+	}
+
+	address := args[0]
+	_, err = getWallet(stub, address)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	dailyLimitKey, err := stub.CreateCompositeKey(dailyLimitIndex, []string{address})
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if limit.Sign() == 0 {
+		err = stub.DelState(dailyLimitKey)
+	} else {
+		err = stub.PutState(dailyLimitKey, []byte(limit.String()))
+	}
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Println(" - END setDailyLimit - ")
+	return successJSON(stub, nil)
+}
+
+/*
+* spendDailyLimit
+* This method counts money a wallet sends against its daily limit, rejecting sends that would go over it
+* The count starts over on the first transfer of every UTC day, wallets without a limit aren't counted
+ */
+
+func spendDailyLimit(stub shim.ChaincodeStubInterface, address string, amount *big.Int, decimals int) error {
+	dailyLimitKey, err := stub.CreateCompositeKey(dailyLimitIndex, []string{address})
+	if err != nil {
+		return err
+	}
+	limitAsBytes, err := stub.GetState(dailyLimitKey)
+	if err != nil {
+		return fmt.Errorf("Failed to get daily limit: %s", err.Error())
+	} else if limitAsBytes == nil {
+		return nil
+	}
+	limit, ok := new(big.Int).SetString(string(limitAsBytes), 10)
+	if !ok {
+		return fmt.Errorf("daily limit %s is not a whole number", limitAsBytes)
+	}
+
+	//The date comes from the transaction so every peer agrees on which day it is
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return err
+	}
+	today := txTime.Format("2006-01-02")
+
+	dailySentKey, err := stub.CreateCompositeKey(dailySentIndex, []string{address})
+	if err != nil {
+		return err
+	}
+	sentAsBytes, err := stub.GetState(dailySentKey)
+	if err != nil {
+		return fmt.Errorf("Failed to get daily sent amount: %s", err.Error())
+	}
+	dailySent := DailySent{Date: today, Sent: new(big.Int)}
+	if sentAsBytes != nil {
+		stored := DailySent{}
+		err = json.Unmarshal(sentAsBytes, &stored)
+		if err != nil {
+			return err
+		}
+		if stored.Date == today && stored.Sent != nil {
+			dailySent.Sent = stored.Sent
+		}
+	}
+
+	sent := new(big.Int).Add(dailySent.Sent, amount)
+	if sent.Cmp(limit) > 0 {
+		return newError(codeForbidden, "daily transfer limit exceeded for wallet %s, %s of %s left today", address, formatAmount(new(big.Int).Sub(limit, dailySent.Sent), decimals), formatAmount(limit, decimals))
+	}
+	dailySent.Sent = sent
+
+	dailySentAsBytes, err := json.Marshal(dailySent)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(dailySentKey, dailySentAsBytes)
+}
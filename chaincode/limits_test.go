@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDailyLimit(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "1000")
+	bob := s.createWallet("bob", "0")
+
+	s.as("bob").fails(codeForbidden, "setDailyLimit", alice, "100")
+	s.ok("setDailyLimit", alice, "100")
+
+	s.ok("transferFunds", alice, bob, "60")
+	s.ok("transferFunds", alice, bob, "40")
+	expectMessage(t, s.fails(codeForbidden, "transferFunds", alice, bob, "1"), "daily transfer limit exceeded for wallet "+alice)
+	s.expectBalance(bob, "100")
+
+	//The next UTC day starts a new count
+	s.now = s.now.Add(24 * time.Hour)
+	s.ok("transferFunds", alice, bob, "100")
+	s.fails(codeForbidden, "transferFunds", alice, bob, "1")
+
+	s.ok("setDailyLimit", alice, "0")
+	s.ok("transferFunds", alice, bob, "500")
+	s.expectBalance(bob, "700")
+}
+
+func TestDailyLimitMessageUsesDecimals(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY", Decimals: 2})
+	alice := s.createWallet("alice", "100.00")
+	bob := s.createWallet("bob", "0")
+
+	s.ok("setDailyLimit", alice, "10.50")
+	s.ok("transferFunds", alice, bob, "2.25")
+	expectMessage(t, s.fails(codeForbidden, "transferFunds", alice, bob, "9.00"), "8.25 of 10.50 left today")
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// While this flag is set no money can move
+const pausedIndex = "paused"
+
+// These functions only read the ledger, so they stay available while the contract is paused
+// pause and unpause are listed too, otherwise a paused contract could never be resumed
+var pauseExempt = map[string]bool{
+	"readWallet":                      true,
+	"queryWallet":                     true,
+	"queryWalletRaw":                  true,
+	"getBalance":                      true,
+	"getWallets":                      true,
+	"getWalletsBatch":                 true,
+	"getWalletsByRange":               true,
+	"getWalletsByRangeWithPagination": true,
+	"getWalletsByBalanceRange":        true,
+	"getTopWallets":                   true,
+	"queryWalletsBySelector":          true,
+	"queryWalletsWithPagination":      true,
+	"queryWalletsByOwner":             true,
+	"getOwnerSummary":                 true,
+	"getWalletChangeLog":              true,
+	"getWalletHistory":                true,
+	"getWalletValueAsOf":              true,
+	"getTotalSupply":                  true,
+	"getTotalSupplyByScan":            true,
+	"auditSupply":                     true,
+	"getWalletCount":                  true,
+	"getWalletCountByScan":            true,
+	"allowance":                       true,
+	"getReceipt":                      true,
+	"getTransaction":                  true,
+	"getTransactionsByRange":          true,
+	"getInfo":                         true,
+	"getEscrow":                       true,
+	"getTokenInfo":                    true,
+	"pause":                           true,
+	"unpause":                         true,
+}
+
+/*
+* readPaused
+* This method returns whether the contract is paused, it's not unless pause was called
+ */
+
+func readPaused(stub shim.ChaincodeStubInterface) (bool, error) {
+	pausedKey, err := stub.CreateCompositeKey(pausedIndex, []string{})
+	if err != nil {
+		return false, err
+	}
+
+	pausedAsBytes, err := stub.GetState(pausedKey)
+	if err != nil {
+		return false, fmt.Errorf("Failed to get paused flag: %s", err.Error())
+	}
+	return pausedAsBytes != nil, nil
+}
+
+/*
+* requireNotPaused
+* This method stops a function that changes the ledger from running while the contract is paused
+* [function]	= This is the name of the function being invoked
+ */
+
+func requireNotPaused(stub shim.ChaincodeStubInterface, function string) error {
+	if pauseExempt[function] {
+		return nil
+	}
+
+	paused, err := readPaused(stub)
+	if err != nil {
+		return err
+	} else if paused {
+		return newError(codeLocked, "contract is paused")
+	}
+	return nil
+}
+
+/*
+* pause
+* This method halts every function that changes the ledger, queries keep working
+ */
+
+func (t *SimpleChaincode) pause(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return t.setPaused(stub, args, true)
+}
+
+/*
+* unpause
+* This method lets a paused contract change the ledger again
+ */
+
+func (t *SimpleChaincode) unpause(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return t.setPaused(stub, args, false)
+}
+
+/*
+* setPaused
+* This method backs both pause and unpause, only the admin can call it, and pausing twice is harmless
+ */
+
+func (t *SimpleChaincode) setPaused(stub shim.ChaincodeStubInterface, args []string, paused bool) pb.Response {
+	op := "unpause"
+	if paused {
+		op = "pause"
+	}
+	if err := requireArgs(op, args, 0); err != nil {
+		return errorFromErr(err)
+	}
+
+	admin, err := isAdmin(stub)
+	if err != nil {
+		return errorFromErr(err)
+	} else if !admin {
+		return errorJSON(codeForbidden, "Only the admin can pause or unpause the contract")
+	}
+
+	pausedKey, err := stub.CreateCompositeKey(pausedIndex, []string{})
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	if paused {
+		err = stub.PutState(pausedKey, []byte{0x01})
+	} else {
+		err = stub.DelState(pausedKey)
+	}
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Println(" - END " + op + " - ")
+	return successJSON(stub, nil)
+}
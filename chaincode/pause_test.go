@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPause(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "0")
+
+	s.as("bob").fails(codeForbidden, "pause")
+	s.ok("pause")
+	s.ok("pause")
+
+	expectMessage(t, s.fails(codeLocked, "transferFunds", alice, bob, "10"), "contract is paused")
+	s.fails(codeLocked, "initWallet", addressOf("carol"), "10")
+	s.ok("queryWallet", alice)
+	s.ok("getBalance", alice)
+	s.ok("getTotalSupply")
+
+	s.ok("unpause")
+	s.ok("transferFunds", alice, bob, "10")
+	s.expectBalance(bob, "10")
+}
@@ -0,0 +1,579 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+* constructQueryResponseFromIterator
+* This method writes the results of a query into a JSON Array of {Key, Record} objects
+ */
+
+func constructQueryResponseFromIterator(resultsIterator shim.StateQueryIteratorInterface) (*bytes.Buffer, error) {
+	//Buffer is a JSON Array containing QueryResults
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+
+	bArrayMemberAlreadyWritten := false
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		//Add a comma before array members, supress ir for the first array member
+		if bArrayMemberAlreadyWritten == true {
+			buffer.WriteString(",")
+		}
+		buffer.WriteString("{\"Key\":")
+		buffer.WriteString("\"")
+		buffer.WriteString(queryResponse.Key)
+		buffer.WriteString("\"")
+
+		buffer.WriteString(", \"Record\":")
+		//Record is a JSON object, so we write as-is
+		buffer.WriteString(string(queryResponse.Value))
+		buffer.WriteString("}")
+		bArrayMemberAlreadyWritten = true
+	}
+	buffer.WriteString("]")
+
+	return &buffer, nil
+}
+
+/*
+* writeQueryRecord
+* This method writes one {Key, Record} object of a JSON Array, the comma goes before every member but the first
+ */
+
+func writeQueryRecord(buffer *bytes.Buffer, key string, record []byte, bArrayMemberAlreadyWritten bool) {
+	if bArrayMemberAlreadyWritten == true {
+		buffer.WriteString(",")
+	}
+	buffer.WriteString("{\"Key\":")
+	buffer.WriteString(strconv.Quote(key))
+	buffer.WriteString(", \"Record\":")
+	//Record is a JSON object, so we write as-is
+	buffer.Write(record)
+	buffer.WriteString("}")
+}
+
+/*
+* addPaginationMetadataToQueryResults
+* This method wraps a page of results together with the metadata needed to fetch the next one
+ */
+
+func addPaginationMetadataToQueryResults(buffer *bytes.Buffer, responseMetadata *pb.QueryResponseMetadata) *bytes.Buffer {
+	var page bytes.Buffer
+	page.WriteString("{\"records\":")
+	page.Write(buffer.Bytes())
+
+	page.WriteString(", \"responseMetadata\":{\"fetchedRecordsCount\":")
+	page.WriteString(strconv.Itoa(int(responseMetadata.FetchedRecordsCount)))
+	page.WriteString(", \"bookmark\":")
+	page.WriteString(strconv.Quote(responseMetadata.Bookmark))
+	page.WriteString("}}")
+
+	return &page
+}
+
+/*
+* getWalletsByRangeWithPagination
+* This method returns one page of the wallets between two keys
+* [startKey]	= This is the first key of the range
+* [endKey]		= This is the key the range ends before
+* [pageSize]	= This is the maximum amount of wallets in the page
+* [bookmark]	= This is the bookmark returned by the previous page, empty for the first one
+* (JSON)		= JSON Document with the records and the metadata for the next page
+ */
+
+func (t *SimpleChaincode) getWalletsByRangeWithPagination(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//		 0			1			2			3
+	//	 startKey	 endKey	   pageSize	   bookmark
+
+	if err := requireArgs("getWalletsByRangeWithPagination", args, 4); err != nil {
+		return errorFromErr(err)
+	}
+
+	startKey := args[0]
+	endKey := args[1]
+	pageSize, err := strconv.ParseInt(args[2], 10, 32)
+	if err != nil || pageSize <= 0 {
+		return errorJSON(codeBadRequest, "3rd Argument must be a positive numeric string")
+	}
+	bookmark := args[3]
+
+	resultsIterator, responseMetadata, err := stub.GetStateByRangeWithPagination(startKey, endKey, int32(pageSize), bookmark)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	defer resultsIterator.Close()
+
+	buffer, err := constructQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	page := addPaginationMetadataToQueryResults(buffer, responseMetadata)
+	fmt.Printf("- get Wallet by RANGE with pagination queryResult:\n%s\n", page.String())
+	return successJSON(stub, page.Bytes())
+}
+
+/*
+* queryWalletsBySelector
+* This method runs a rich query over the wallets, it only works when the peers use CouchDB as their state database
+* The balance is saved as a string, which CouchDB compares by collation, so amounts are filtered on balanceValue,
+* the same balance saved as a number of minor units, e.g. 100.00 with 2 decimals is 10000
+* [selector]	= This is a CouchDB (Mango) query, e.g. {"selector":{"owner":"alice","balanceValue":{"$gt":10000}}}
+* (JSON)		= JSON Array with the matching wallets
+ */
+
+func (t *SimpleChaincode) queryWalletsBySelector(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("queryWalletsBySelector", args, 1); err != nil {
+		return errorFromErr(err)
+	}
+
+	queryString := args[0]
+	if err := requireNonEmpty(args[:1]...); err != nil {
+		return errorFromErr(err)
+	}
+
+	queryResults, err := getQueryResultForQueryString(stub, queryString)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Printf("- queryWalletsBySelector queryResult:\n%s\n", string(queryResults))
+	return successJSON(stub, queryResults)
+}
+
+/*
+* queryWalletsWithPagination
+* This method returns one page of a rich query over the wallets, it only works on CouchDB
+* [selector]	= This is a CouchDB (Mango) query, e.g. {"selector":{"owner":"alice"}}
+* [pageSize]	= This is the maximum amount of wallets in the page
+* [bookmark]	= This is the bookmark returned by the previous page, empty for the first one
+* (JSON)		= JSON Document with the records and the metadata for the next page
+ */
+
+func (t *SimpleChaincode) queryWalletsWithPagination(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//		 0			1			2
+	//	 selector	 pageSize	 bookmark
+
+	if err := requireArgs("queryWalletsWithPagination", args, 3); err != nil {
+		return errorFromErr(err)
+	}
+
+	queryString := args[0]
+	if err := requireNonEmpty(args[:1]...); err != nil {
+		return errorFromErr(err)
+	}
+	pageSize, err := strconv.ParseInt(args[1], 10, 32)
+	if err != nil || pageSize <= 0 {
+		return errorJSON(codeBadRequest, "2nd Argument must be a positive numeric string")
+	}
+	bookmark := args[2]
+
+	resultsIterator, responseMetadata, err := stub.GetQueryResultWithPagination(queryString, int32(pageSize), bookmark)
+	if err != nil {
+		return errorJSON(codeInternal, "Rich queries require CouchDB as the state database: "+err.Error())
+	}
+	defer resultsIterator.Close()
+
+	buffer, err := constructQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	page := addPaginationMetadataToQueryResults(buffer, responseMetadata)
+	fmt.Printf("- queryWalletsWithPagination queryResult:\n%s\n", page.String())
+	return successJSON(stub, page.Bytes())
+}
+
+/*
+* queryWalletsByOwner
+* This method returns every wallet held by an owner using the owner~id index
+* [owner]	= This is the holder of the wallets
+* (JSON)	= JSON Array with the wallets of the owner, empty when they hold none
+ */
+
+func (t *SimpleChaincode) queryWalletsByOwner(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("queryWalletsByOwner", args, 1); err != nil {
+		return errorFromErr(err)
+	}
+
+	owner := args[0]
+	if err := requireNonEmpty(args[:1]...); err != nil {
+		return errorFromErr(err)
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(ownerIDIndex, []string{owner})
+	if err != nil {
+		return errorFromErr(err)
+	}
+	defer resultsIterator.Close()
+
+	//Buffer is a JSON Array containing the Wallets the index points to
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+
+	bArrayMemberAlreadyWritten := false
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return errorFromErr(err)
+		}
+
+		_, keyParts, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return errorFromErr(err)
+		}
+		address := keyParts[1]
+
+		walletAsBytes, err := stub.GetState(address)
+		if err != nil {
+			return errorJSON(codeInternal, "Failed to get Wallet: "+err.Error())
+		} else if walletAsBytes == nil {
+			continue
+		}
+
+		writeQueryRecord(&buffer, address, walletAsBytes, bArrayMemberAlreadyWritten)
+		bArrayMemberAlreadyWritten = true
+	}
+	buffer.WriteString("]")
+
+	fmt.Printf("- queryWalletsByOwner queryResult:\n%s\n", buffer.String())
+	return successJSON(stub, buffer.Bytes())
+}
+
+/*
+* getTopWallets
+* This method returns the wallets of a key range sorted by balance, e.g. the 10 richest ones
+* Every wallet of the range is loaded and sorted in memory, so it's meant for bounded ranges, not the whole ledger
+* [startKey]	= This is the first id of the range
+* [endKey]	= This is the id the range stops before
+* [limit]	= This is the maximum amount of wallets returned
+* [order]	= (Optional) This is "desc" for the richest first or "asc" for the poorest first, it defaults to "desc"
+* (JSON)	= JSON Array of {Key, Record} objects in balance order
+ */
+
+func (t *SimpleChaincode) getTopWallets(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//		 0			1		2		3
+	//	 startKey	  endKey  limit	  order
+
+	if err := requireArgsBetween("getTopWallets", args, 3, 4); err != nil {
+		return errorFromErr(err)
+	}
+
+	limit, err := strconv.Atoi(args[2])
+	if err != nil || limit <= 0 {
+		return errorJSON(codeBadRequest, "3rd Argument must be a positive number")
+	}
+	descending := true
+	if len(args) > 3 {
+		switch args[3] {
+		case "asc":
+			descending = false
+		case "desc":
+		default:
+			return errorJSON(codeBadRequest, "4th Argument must be either asc or desc")
+		}
+	}
+
+	resultsIterator, err := stub.GetStateByRange(args[0], args[1])
+	if err != nil {
+		return errorFromErr(err)
+	}
+	defer resultsIterator.Close()
+
+	wallets := []Wallet{}
+	records := map[string][]byte{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return errorFromErr(err)
+		}
+
+		wallet, err := unmarshalWallet(queryResponse.Key, queryResponse.Value)
+		if err != nil {
+			return errorFromErr(err)
+		} else if wallet.Address != queryResponse.Key {
+			continue
+		}
+		wallets = append(wallets, wallet)
+		records[wallet.Address] = queryResponse.Value
+	}
+
+	//Wallets with the same balance keep their key order, so the answer is the same on every endorser
+	sort.SliceStable(wallets, func(i, j int) bool {
+		if descending {
+			return wallets[i].Balance.Cmp(wallets[j].Balance) > 0
+		}
+		return wallets[i].Balance.Cmp(wallets[j].Balance) < 0
+	})
+	if len(wallets) > limit {
+		wallets = wallets[:limit]
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+	for i, wallet := range wallets {
+		writeQueryRecord(&buffer, wallet.Address, records[wallet.Address], i > 0)
+	}
+	buffer.WriteString("]")
+
+	return successJSON(stub, buffer.Bytes())
+}
+
+/*
+* getWallets
+* This method returns several wallets in one invocation
+* [ids]		= This is a JSON Array with the ids of the wallets
+* (JSON)	= JSON Document mapping every id to its wallet, null when it doesn't exist
+ */
+
+func (t *SimpleChaincode) getWallets(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("getWallets", args, 1); err != nil {
+		return errorFromErr(err)
+	}
+
+	addresses, records, err := readWallets(stub, args[0])
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	wallets := map[string]json.RawMessage{}
+	for i, address := range addresses {
+		wallets[address] = records[i]
+	}
+
+	walletsAsBytes, err := json.Marshal(wallets)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	return successJSON(stub, walletsAsBytes)
+}
+
+/*
+* getWalletsBatch
+* This method returns several wallets in one invocation, in the order they were asked for
+* [ids]		= This is a JSON Array with the ids of the wallets
+* (JSON)	= JSON Array with the wallet of every id, null when it doesn't exist
+ */
+
+func (t *SimpleChaincode) getWalletsBatch(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("getWalletsBatch", args, 1); err != nil {
+		return errorFromErr(err)
+	}
+
+	_, records, err := readWallets(stub, args[0])
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	walletsAsBytes, err := json.Marshal(records)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	return successJSON(stub, walletsAsBytes)
+}
+
+/*
+* readWallets
+* This method reads the wallets of a JSON Array of ids, a missing wallet reads as nil so it's written as null
+ */
+
+func readWallets(stub shim.ChaincodeStubInterface, ids string) ([]string, []json.RawMessage, error) {
+	addresses := []string{}
+	err := json.Unmarshal([]byte(ids), &addresses)
+	if err != nil {
+		return nil, nil, newError(codeBadRequest, "1st Argument must be a JSON Array of ids: %s", err.Error())
+	}
+
+	records := make([]json.RawMessage, len(addresses))
+	for i, address := range addresses {
+		walletAsBytes, err := stub.GetState(address)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to get Wallet: %s", err.Error())
+		} else if walletAsBytes == nil {
+			continue
+		}
+		_, err = unmarshalWallet(address, walletAsBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		records[i] = walletAsBytes
+	}
+	return addresses, records, nil
+}
+
+/*
+* getOwnerSummary
+* This method adds up the wallets held by an owner using the owner~id index
+* [owner]	= This is the holder of the wallets
+* (JSON)	= JSON Document with the walletCount, totalBalance and totalHeld of the owner, zeros when they hold none
+ */
+
+func (t *SimpleChaincode) getOwnerSummary(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("getOwnerSummary", args, 1); err != nil {
+		return errorFromErr(err)
+	}
+
+	owner := args[0]
+	if err := requireNonEmpty(args[:1]...); err != nil {
+		return errorFromErr(err)
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(ownerIDIndex, []string{owner})
+	if err != nil {
+		return errorFromErr(err)
+	}
+	defer resultsIterator.Close()
+
+	walletCount := 0
+	totalBalance := new(big.Int)
+	totalHeld := new(big.Int)
+	totalReserved := new(big.Int)
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return errorFromErr(err)
+		}
+
+		_, keyParts, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return errorFromErr(err)
+		}
+
+		//The index can outlive a Wallet, those entries are skipped like queryWalletsByOwner does
+		wallet, err := getWallet(stub, keyParts[1])
+		if err != nil {
+			if errorCode(err) == codeNotFound {
+				continue
+			}
+			return errorFromErr(err)
+		}
+
+		walletCount++
+		totalBalance.Add(totalBalance, wallet.Balance)
+		totalHeld.Add(totalHeld, wallet.Held)
+		totalReserved.Add(totalReserved, wallet.Reserved)
+	}
+
+	//The totals are written as decimal strings in the configured decimals, like getBalance does
+	summaryAsBytes, err := json.Marshal(struct {
+		WalletCount   int    `json:"walletCount"`
+		TotalBalance  string `json:"totalBalance"`
+		TotalHeld     string `json:"totalHeld"`
+		TotalReserved string `json:"totalReserved"`
+	}{walletCount, formatAmount(totalBalance, config.Decimals), formatAmount(totalHeld, config.Decimals), formatAmount(totalReserved, config.Decimals)})
+	if err != nil {
+		return errorFromErr(err)
+	}
+	return successJSON(stub, summaryAsBytes)
+}
+
+/*
+* getQueryResultForQueryString
+* This method runs a rich query and returns the results as a JSON Array of {Key, Record} objects
+ */
+
+func getQueryResultForQueryString(stub shim.ChaincodeStubInterface, queryString string) ([]byte, error) {
+	resultsIterator, err := stub.GetQueryResult(queryString)
+	if err != nil {
+		return nil, fmt.Errorf("Rich queries require CouchDB as the state database: %s", err.Error())
+	}
+	defer resultsIterator.Close()
+
+	buffer, err := constructQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+/*
+* getWalletsByBalanceRange
+* This method returns the wallets whose balance is between two amounts using the address~balance index
+* Balances are stored as text on the index so they are parsed and compared as numbers
+* [min]		= This is the lowest balance to include, in the configured decimals
+* [max]		= This is the highest balance to include, in the configured decimals
+* (JSON)	= JSON Array with the matching wallets
+ */
+
+func (t *SimpleChaincode) getWalletsByBalanceRange(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//		 0		 1
+	//		min		max
+
+	if err := requireArgs("getWalletsByBalanceRange", args, 2); err != nil {
+		return errorFromErr(err)
+	}
+
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	min, err := parseAmount(args[0], config.Decimals)
+	if err != nil {
+		return errorJSON(codeBadRequest, "1st Argument must be a numeric string: "+err.Error())
+	}
+	max, err := parseAmount(args[1], config.Decimals)
+	if err != nil {
+		return errorJSON(codeBadRequest, "2nd Argument must be a numeric string: "+err.Error())
+	}
+	if min.Cmp(max) > 0 {
+		return errorJSON(codeBadRequest, "1st Argument can't be greater than the 2nd")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(addressBalanceIndex, []string{})
+	if err != nil {
+		return errorFromErr(err)
+	}
+	defer resultsIterator.Close()
+
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+
+	bArrayMemberAlreadyWritten := false
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return errorFromErr(err)
+		}
+
+		_, keyParts, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return errorFromErr(err)
+		}
+		address := keyParts[0]
+		balance, ok := new(big.Int).SetString(keyParts[1], 10)
+		if !ok || balance.Cmp(min) < 0 || balance.Cmp(max) > 0 {
+			continue
+		}
+
+		walletAsBytes, err := stub.GetState(address)
+		if err != nil {
+			return errorJSON(codeInternal, "Failed to get Wallet: "+err.Error())
+		} else if walletAsBytes == nil {
+			continue
+		}
+
+		writeQueryRecord(&buffer, address, walletAsBytes, bArrayMemberAlreadyWritten)
+		bArrayMemberAlreadyWritten = true
+	}
+	buffer.WriteString("]")
+
+	fmt.Printf("- getWalletsByBalanceRange queryResult:\n%s\n", buffer.String())
+	return successJSON(stub, buffer.Bytes())
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func TestRangePagination(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	for i := 0; i < 25; i++ {
+		s.createWallet(fmt.Sprintf("wallet%d", i), "1")
+	}
+
+	page := struct {
+		Records          []queryRecord `json:"records"`
+		ResponseMetadata struct {
+			FetchedRecordsCount int    `json:"fetchedRecordsCount"`
+			Bookmark            string `json:"bookmark"`
+		} `json:"responseMetadata"`
+	}{}
+	seen := map[string]bool{}
+	sizes := []string{}
+	bookmark := ""
+	for {
+		decode(t, s.ok("getWalletsByRangeWithPagination", "", "", "10", bookmark).Data, &page)
+		sizes = append(sizes, fmt.Sprint(page.ResponseMetadata.FetchedRecordsCount))
+		for _, record := range page.Records {
+			if seen[record.Key] || record.Key < bookmark {
+				t.Fatalf("wallet %s came back twice or out of order", record.Key)
+			}
+			seen[record.Key] = true
+		}
+		if page.ResponseMetadata.Bookmark == "" {
+			break
+		}
+		if page.ResponseMetadata.Bookmark == bookmark {
+			t.Fatal("the bookmark didn't advance")
+		}
+		bookmark = page.ResponseMetadata.Bookmark
+	}
+	expectKeys(t, sizes, "10", "10", "5")
+	if len(seen) != 25 {
+		t.Fatalf("paged through %d wallets instead of 25", len(seen))
+	}
+	s.fails(codeBadRequest, "getWalletsByRangeWithPagination", "", "", "0", "")
+}
+
+func TestQueryWalletsBySelector(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.idOf("alice")
+	for i := 0; i < 3; i++ {
+		s.createWallet(fmt.Sprintf("alice%d", i), fmt.Sprint(100*(i+1)), "", alice)
+	}
+	s.createWallet("bob", "1000", "", "bob")
+	selector := "{\"selector\":{\"owner\":\"" + alice + "\"}}"
+
+	expectMessage(t, s.fails(codeInternal, "queryWalletsBySelector", selector), "Rich queries require CouchDB")
+
+	s.couchDB = true
+	records := []queryRecord{}
+	decode(t, s.ok("queryWalletsBySelector", selector).Data, &records)
+	if len(records) != 3 {
+		t.Fatalf("selector matched %d wallets instead of 3", len(records))
+	}
+	decode(t, s.ok("queryWalletsBySelector", "{\"selector\":{\"balanceValue\":{\"$gt\":150}}}").Data, &records)
+	if len(records) != 3 {
+		t.Fatalf("balanceValue selector matched %d wallets instead of 3", len(records))
+	}
+	s.fails(codeBadRequest, "queryWalletsBySelector", "")
+}
+
+func TestQueryWalletsByOwner(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice1 := s.createWallet("alice1", "10", "", "alice")
+	bob1 := s.createWallet("bob1", "20", "", "bob")
+	alice2 := s.createWallet("alice2", "30", "", "alice")
+	bob2 := s.createWallet("bob2", "40", "", "bob")
+
+	records := []queryRecord{}
+	decode(t, s.ok("queryWalletsByOwner", "alice").Data, &records)
+	expected := []string{alice1, alice2}
+	sort.Strings(expected)
+	expectKeys(t, recordKeys(records), expected...)
+
+	decode(t, s.ok("queryWalletsByOwner", "bob").Data, &records)
+	expected = []string{bob1, bob2}
+	sort.Strings(expected)
+	expectKeys(t, recordKeys(records), expected...)
+
+	decode(t, s.ok("queryWalletsByOwner", "carol").Data, &records)
+	expectKeys(t, recordKeys(records))
+}
+
+func TestBalanceIndexFollowsTransfers(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	ten := s.createWallet("ten", "10")
+	hundred := s.createWallet("hundred", "100")
+
+	//After a transfer the wallets show up under their new balance, and only there
+	s.ok("transferFunds", hundred, ten, "30")
+	records := []queryRecord{}
+	decode(t, s.ok("getWalletsByBalanceRange", "35", "45").Data, &records)
+	expectKeys(t, recordKeys(records), ten)
+	decode(t, s.ok("getWalletsByBalanceRange", "70", "70").Data, &records)
+	expectKeys(t, recordKeys(records), hundred)
+	decode(t, s.ok("getWalletsByBalanceRange", "90", "100").Data, &records)
+	expectKeys(t, recordKeys(records))
+	if s.State[s.compositeKey(addressBalanceIndex, hundred, "100")] != nil {
+		t.Fatal("the old balance is still indexed")
+	}
+}
+
+func TestQueryWalletsByOwnerEscapesRecords(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+
+	//Owners with characters JSON has to escape still come back as valid JSON
+	odd := "o\"w\\n{e}r"
+	carol := s.createWallet("carol", "5", "", odd)
+	s.createWallet("dave", "5", "", "o")
+	response := s.ok("queryWalletsByOwner", odd)
+	records := []queryRecord{}
+	decode(t, response.Data, &records)
+	if len(records) != 1 || records[0].Key != carol || records[0].Record.Owner != odd {
+		t.Fatalf("unexpected records %s", response.Data)
+	}
+}
+
+func TestBalanceRange(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	s.createWallet("ten", "10")
+	fifty := s.createWallet("fifty", "50")
+	hundred := s.createWallet("hundred", "100")
+	s.createWallet("thousand", "1000")
+
+	//Both ends of the range are included
+	records := []queryRecord{}
+	decode(t, s.ok("getWalletsByBalanceRange", "20", "100").Data, &records)
+	keys := recordKeys(records)
+	sort.Strings(keys)
+	expected := []string{fifty, hundred}
+	sort.Strings(expected)
+	expectKeys(t, keys, expected...)
+
+	s.fails(codeBadRequest, "getWalletsByBalanceRange", "100", "20")
+	s.fails(codeBadRequest, "getWalletsByBalanceRange", "abc", "20")
+}
+
+func TestOwnerSummary(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	first := s.createWallet("alice1", "100", "", "alice")
+	s.createWallet("alice2", "50", "", "alice")
+	s.createWallet("bob", "1000", "", "bob")
+	s.ok("placeHold", first, "20")
+
+	summary := struct {
+		WalletCount  int    `json:"walletCount"`
+		TotalBalance string `json:"totalBalance"`
+		TotalHeld    string `json:"totalHeld"`
+	}{}
+	decode(t, s.ok("getOwnerSummary", "alice").Data, &summary)
+	if summary.WalletCount != 2 || summary.TotalBalance != "130" || summary.TotalHeld != "20" {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+	decode(t, s.ok("getOwnerSummary", "nobody").Data, &summary)
+	if summary.WalletCount != 0 || summary.TotalBalance != "0" {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+}
+
+func TestGetWallets(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "10")
+	bob := s.createWallet("bob", "20")
+	nobody := addressOf("nobody")
+
+	//Missing wallets come back as null instead of failing the whole read
+	wallets := map[string]*Wallet{}
+	decode(t, s.ok("getWallets", fmt.Sprintf("[%q,%q,%q]", nobody, bob, alice)).Data, &wallets)
+	if len(wallets) != 3 || wallets[nobody] != nil || wallets[alice].Balance.String() != "10" || wallets[bob].Balance.String() != "20" {
+		t.Fatalf("unexpected wallets %+v", wallets)
+	}
+	s.fails(codeBadRequest, "getWallets", "not an array")
+}
+
+func TestTopWallets(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	balances := map[string]string{}
+	for name, balance := range map[string]string{"a": "10", "b": "300", "c": "50", "d": "200", "e": "100"} {
+		balances[s.createWallet(name, balance)] = balance
+	}
+
+	balancesOf := func(function string, args ...string) []string {
+		records := []queryRecord{}
+		decode(t, s.ok(function, args...).Data, &records)
+		result := []string{}
+		for _, record := range records {
+			result = append(result, record.Record.Balance.String())
+		}
+		return result
+	}
+	expectKeys(t, balancesOf("getTopWallets", "", "", "3"), "300", "200", "100")
+	expectKeys(t, balancesOf("getTopWallets", "", "", "2", "asc"), "10", "50")
+	expectKeys(t, balancesOf("getTopWallets", "", "", "10"), "300", "200", "100", "50", "10")
+	s.fails(codeBadRequest, "getTopWallets", "", "", "0")
+	s.fails(codeBadRequest, "getTopWallets", "", "", "3", "sideways")
+}
+
+func TestGetWalletsBatch(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "10")
+	bob := s.createWallet("bob", "20")
+	nobody := addressOf("nobody")
+
+	//The wallets come back in the order they were asked for, with null for missing ones
+	batch := []*Wallet{}
+	decode(t, s.ok("getWalletsBatch", fmt.Sprintf("[%q,%q,%q,%q]", nobody, bob, alice, bob)).Data, &batch)
+	if len(batch) != 4 || batch[0] != nil || batch[1].Address != bob || batch[2].Address != alice || batch[3].Address != bob {
+		t.Fatalf("unexpected wallets %+v", batch)
+	}
+	s.fails(codeBadRequest, "getWalletsBatch", "not an array")
+}
+
+func TestQueryWalletsWithPagination(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.idOf("alice")
+	for i := 0; i < 3; i++ {
+		s.createWallet(fmt.Sprintf("alice%d", i), "1", "", alice)
+	}
+	s.createWallet("bob", "1", "", "bob")
+	selector := "{\"selector\":{\"owner\":\"" + alice + "\"}}"
+
+	expectMessage(t, s.fails(codeInternal, "queryWalletsWithPagination", selector, "2", ""), "Rich queries require CouchDB")
+
+	s.couchDB = true
+	page := struct {
+		Records          []queryRecord `json:"records"`
+		ResponseMetadata struct {
+			FetchedRecordsCount int    `json:"fetchedRecordsCount"`
+			Bookmark            string `json:"bookmark"`
+		} `json:"responseMetadata"`
+	}{}
+	decode(t, s.ok("queryWalletsWithPagination", selector, "2", "").Data, &page)
+	if len(page.Records) != 2 || page.ResponseMetadata.FetchedRecordsCount != 2 || page.ResponseMetadata.Bookmark == "" {
+		t.Fatalf("unexpected first page %+v", page)
+	}
+	firstPage := recordKeys(page.Records)
+	decode(t, s.ok("queryWalletsWithPagination", selector, "2", page.ResponseMetadata.Bookmark).Data, &page)
+	if len(page.Records) != 1 || page.ResponseMetadata.Bookmark != "" || page.Records[0].Key <= firstPage[1] {
+		t.Fatalf("second page didn't continue where the first left off %+v", page)
+	}
+	s.fails(codeBadRequest, "queryWalletsWithPagination", selector, "-1", "")
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+* Define the ExchangeRate Structure, it's the rate of a currency against the base currency
+* [Currency] <-- Currency being valued
+* [Rate] <-- Amount of base currency one unit of the currency is worth
+* [EffectiveAt] <-- RFC3339 timestamp from which the rate applies
+ */
+type ExchangeRate struct {
+	Currency    string  `json:"currency"`
+	Rate        float64 `json:"rate"`
+	EffectiveAt string  `json:"effectiveAt"`
+}
+
+// Rates are indexed by currency and a zero padded unix time so they iterate in chronological order
+const rateIndex = "currency~effectiveAt"
+
+/*
+* setExchangeRate
+* This method records the rate of a currency from a point in time onwards, only the admin can call it
+* [currency]	= This is the currency being valued
+* [rate]		= This is the amount of base currency one unit is worth
+* [effectiveAt]	= This is the RFC3339 timestamp from which the rate applies
+ */
+
+func (t *SimpleChaincode) setExchangeRate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//		 0			1			2
+	//	 Currency	  Rate	   EffectiveAt
+
+	if err := requireArgs("setExchangeRate", args, 3); err != nil {
+		return errorFromErr(err)
+	}
+
+	admin, err := isAdmin(stub)
+	if err != nil {
+		return errorFromErr(err)
+	} else if !admin {
+		return errorJSON(codeForbidden, "Only the admin can set exchange rates")
+	}
+
+	currency := args[0]
+	if err := requireNonEmpty(args[:1]...); err != nil {
+		return errorFromErr(err)
+	}
+
+	rate, err := strconv.ParseFloat(args[1], 64)
+	if err != nil || rate <= 0 {
+		return errorJSON(codeBadRequest, "2nd Argument must be a positive numeric string")
+	}
+
+	effectiveAt, err := time.Parse(time.RFC3339, args[2])
+	if err != nil {
+		return errorJSON(codeBadRequest, "3rd Argument must be an RFC3339 timestamp")
+	}
+
+	rateKey, err := stub.CreateCompositeKey(rateIndex, []string{currency, fmt.Sprintf("%020d", effectiveAt.Unix())})
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	exchangeRate := ExchangeRate{Currency: currency, Rate: rate, EffectiveAt: effectiveAt.UTC().Format(time.RFC3339)}
+	exchangeRateAsBytes, err := json.Marshal(exchangeRate)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	err = stub.PutState(rateKey, exchangeRateAsBytes)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Println(" - END setExchangeRate - ")
+	return successJSON(stub, nil)
+}
+
+/*
+* getRateAsOf
+* This method returns the rate of a currency that was effective at a point in time
+ */
+
+func getRateAsOf(stub shim.ChaincodeStubInterface, currency string, asOf time.Time) (ExchangeRate, error) {
+	exchangeRate := ExchangeRate{}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(rateIndex, []string{currency})
+	if err != nil {
+		return exchangeRate, err
+	}
+	defer resultsIterator.Close()
+
+	//Rates come in chronological order, so the last one before the timestamp wins
+	found := false
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return exchangeRate, err
+		}
+
+		_, keyParts, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return exchangeRate, err
+		}
+		effectiveAt, err := strconv.ParseInt(keyParts[1], 10, 64)
+		if err != nil {
+			return exchangeRate, err
+		}
+		if effectiveAt > asOf.Unix() {
+			break
+		}
+
+		err = json.Unmarshal(queryResponse.Value, &exchangeRate)
+		if err != nil {
+			return exchangeRate, err
+		}
+		found = true
+	}
+
+	if !found {
+		return exchangeRate, newError(codeNotFound, "No exchange rate for %s as of %s", currency, asOf.UTC().Format(time.RFC3339))
+	}
+	return exchangeRate, nil
+}
+
+/*
+* getWalletValueAsOf
+* This method values the balance, held and reserved money of a wallet using the rate effective at a point in time
+* [id]		= This is the id for the wallet
+* [asOf]	= This is the RFC3339 timestamp to value the wallet at
+* (JSON)	= JSON Document with the value per currency and the total in the base currency
+ */
+
+func (t *SimpleChaincode) getWalletValueAsOf(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//		 0			1
+	//	  Address	  AsOf
+
+	if err := requireArgs("getWalletValueAsOf", args, 2); err != nil {
+		return errorFromErr(err)
+	}
+
+	address := args[0]
+	asOf, err := time.Parse(time.RFC3339, args[1])
+	if err != nil {
+		return errorJSON(codeBadRequest, "2nd Argument must be an RFC3339 timestamp")
+	}
+
+	wallet, err := getWallet(stub, address)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	//Balances in the base currency are worth exactly their amount
+	currency := wallet.Currency
+	rate := 1.0
+	if currency == "" {
+		currency = config.BaseCurrency
+	} else if currency != config.BaseCurrency {
+		exchangeRate, err := getRateAsOf(stub, currency, asOf)
+		if err != nil {
+			return errorFromErr(err)
+		}
+		rate = exchangeRate.Rate
+	}
+
+	type currencyValue struct {
+		Currency string      `json:"currency"`
+		Balance  json.Number `json:"balance"`
+		Held     json.Number `json:"held"`
+		Reserved json.Number `json:"reserved"`
+		Rate     float64     `json:"rate"`
+		Value    float64     `json:"value"`
+	}
+
+	//Held and reserved money still belongs to the wallet, so it's valued along with the balance
+	//Valuations are only reported, so the precision a float64 offers is enough here
+	holdings := new(big.Float).SetInt(new(big.Int).Add(new(big.Int).Add(wallet.Balance, wallet.Held), wallet.Reserved))
+	holdings.Quo(holdings, new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(config.Decimals)), nil)))
+	value, _ := holdings.Mul(holdings, big.NewFloat(rate)).Float64()
+	response := struct {
+		Address      string          `json:"address"`
+		AsOf         string          `json:"asOf"`
+		BaseCurrency string          `json:"baseCurrency"`
+		Values       []currencyValue `json:"values"`
+		Total        float64         `json:"total"`
+	}{
+		Address:      address,
+		AsOf:         asOf.UTC().Format(time.RFC3339),
+		BaseCurrency: config.BaseCurrency,
+		Values:       []currencyValue{{Currency: currency, Balance: json.Number(formatAmount(wallet.Balance, config.Decimals)), Held: json.Number(formatAmount(wallet.Held, config.Decimals)), Reserved: json.Number(formatAmount(wallet.Reserved, config.Decimals)), Rate: rate, Value: value}},
+		Total:        value,
+	}
+
+	responseAsBytes, err := json.Marshal(response)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Printf("- getWalletValueAsOf queryResult:\n%s\n", string(responseAsBytes))
+	return successJSON(stub, responseAsBytes)
+}
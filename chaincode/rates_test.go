@@ -0,0 +1,35 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestExchangeRates(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY", BaseCurrency: "USD"})
+	alice := s.createWallet("alice", "100", "EUR")
+	bob := s.createWallet("bob", "100")
+
+	s.as("bob").fails(codeForbidden, "setExchangeRate", "EUR", "1.1", "2018-01-01T00:00:00Z")
+	s.ok("setExchangeRate", "EUR", "1.1", "2018-01-01T00:00:00Z")
+	s.ok("setExchangeRate", "EUR", "1.2", "2018-06-01T00:00:00Z")
+
+	valueAsOf := func(address string, asOf string) float64 {
+		value := struct {
+			Total float64 `json:"total"`
+		}{}
+		decode(t, s.ok("getWalletValueAsOf", address, asOf).Data, &value)
+		return value.Total
+	}
+	if value := valueAsOf(alice, "2018-03-01T00:00:00Z"); math.Abs(value-110) > 1e-9 {
+		t.Fatalf("value in March is %f", value)
+	}
+	if value := valueAsOf(alice, "2018-07-01T00:00:00Z"); math.Abs(value-120) > 1e-9 {
+		t.Fatalf("value in July is %f", value)
+	}
+	if value := valueAsOf(bob, "2017-01-01T00:00:00Z"); value != 100 {
+		t.Fatalf("base currency is valued at %f", value)
+	}
+	s.fails(codeNotFound, "getWalletValueAsOf", alice, "2017-12-31T00:00:00Z")
+}
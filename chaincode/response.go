@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Successful invocations report this status, the same one shim.Success uses
+const codeOK = 200
+
+/*
+* Define the Response Structure, every invocation answers with one of these as JSON
+* [Status] <-- HTTP-style code of the invocation, 200 on success
+* [Message] <-- Human readable description of the failure, empty on success
+* [Data] <-- JSON Document the handler returned, if any
+* [TxID] <-- Transaction that served the invocation
+ */
+type Response struct {
+	Status  int             `json:"status"`
+	Message string          `json:"message,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	TxID    string          `json:"txId,omitempty"`
+}
+
+/*
+* successJSON
+* This method answers a successful invocation with the Response wrapping the data as its payload
+* [data]	= This is the JSON Document the handler returns, nil when there's nothing to return
+ */
+
+func successJSON(stub shim.ChaincodeStubInterface, data []byte) pb.Response {
+	responseAsBytes, err := json.Marshal(Response{Status: codeOK, Data: data, TxID: stub.GetTxID()})
+	if err != nil {
+		return errorJSON(codeInternal, err.Error())
+	}
+	return shim.Success(responseAsBytes)
+}
+
+/*
+* errorJSON
+* This method answers a failed invocation with the Response as its message, the only part Fabric hands back on errors
+* [code]	= This is the HTTP-style code of the failure
+* [message]	= This is the description of the failure
+ */
+
+func errorJSON(code int, message string) pb.Response {
+	responseAsBytes, _ := json.Marshal(Response{Status: code, Message: message})
+	return pb.Response{Status: int32(code), Message: string(responseAsBytes)}
+}
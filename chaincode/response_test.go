@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestErrorShape(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+
+	peerResponse := s.run("admin", false, []string{"getBalance", addressOf("nobody")})
+	if peerResponse.Payload != nil {
+		t.Fatalf("failure carried a payload %s", peerResponse.Payload)
+	}
+	fields := map[string]json.RawMessage{}
+	decode(t, []byte(peerResponse.Message), &fields)
+	if len(fields) != 2 || string(fields["status"]) != "404" || fields["message"] == nil {
+		t.Fatalf("unexpected failure shape %s", peerResponse.Message)
+	}
+
+	for _, failure := range []struct {
+		code     int
+		function string
+		args     []string
+	}{
+		{codeBadRequest, "queryWallet", nil},
+		{codeBadRequest, "doesNotExist", nil},
+		{codeNotFound, "queryWallet", []string{addressOf("nobody")}},
+		{codeInsufficientFunds, "transferFunds", []string{alice, s.createWallet("bob", "0"), "500"}},
+		{codeForbidden, "deleteWallet", []string{alice}},
+	} {
+		caller := s.as("admin")
+		if failure.code == codeForbidden {
+			caller = s.as("mallory")
+		}
+		response := caller.fails(failure.code, failure.function, failure.args...)
+		if response.Message == "" || response.Data != nil || response.TxID != "" {
+			t.Fatalf("unexpected failure %+v", response)
+		}
+	}
+}
+
+func TestSuccessShape(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+
+	peerResponse := s.run("admin", false, []string{"getBalance", alice})
+	if peerResponse.Message != "" {
+		t.Fatalf("success carried a message %q", peerResponse.Message)
+	}
+	fields := map[string]json.RawMessage{}
+	decode(t, peerResponse.Payload, &fields)
+	if len(fields) != 3 || string(fields["status"]) != "200" || fields["data"] == nil || fields["txId"] == nil {
+		t.Fatalf("unexpected success shape %s", peerResponse.Payload)
+	}
+}
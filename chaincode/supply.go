@@ -0,0 +1,365 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// The amount of money in circulation is kept as a single counter
+const totalSupplyIndex = "totalSupply"
+
+/*
+* readTotalSupply
+* This method returns the amount of money in circulation, zero when nothing was ever minted
+ */
+
+func readTotalSupply(stub shim.ChaincodeStubInterface) (*big.Int, error) {
+	totalSupplyKey, err := stub.CreateCompositeKey(totalSupplyIndex, []string{})
+	if err != nil {
+		return nil, err
+	}
+
+	totalSupplyAsBytes, err := stub.GetState(totalSupplyKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get total supply: %s", err.Error())
+	} else if totalSupplyAsBytes == nil {
+		return new(big.Int), nil
+	}
+
+	totalSupply, ok := new(big.Int).SetString(string(totalSupplyAsBytes), 10)
+	if !ok {
+		return nil, fmt.Errorf("total supply %s is not a whole number", totalSupplyAsBytes)
+	}
+	return totalSupply, nil
+}
+
+/*
+* writeTotalSupply
+* This method saves the amount of money in circulation
+ */
+
+func writeTotalSupply(stub shim.ChaincodeStubInterface, totalSupply *big.Int) error {
+	totalSupplyKey, err := stub.CreateCompositeKey(totalSupplyIndex, []string{})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(totalSupplyKey, []byte(totalSupply.String()))
+}
+
+/*
+* reduceTotalSupply
+* This method takes the balance of deleted wallets out of circulation, never letting the supply go negative
+ */
+
+func reduceTotalSupply(stub shim.ChaincodeStubInterface, amount *big.Int) error {
+	totalSupply, err := readTotalSupply(stub)
+	if err != nil {
+		return err
+	}
+	totalSupply = new(big.Int).Sub(totalSupply, amount)
+	if totalSupply.Sign() < 0 {
+		totalSupply = new(big.Int)
+	}
+	return writeTotalSupply(stub, totalSupply)
+}
+
+/*
+* mint
+* This method creates new money into a wallet, only the issuer can call it
+* It's also routed as mintFunds
+* [id]		= This is the id for the wallet receiving the money
+* [amount]	= This is the amount of money being created
+ */
+
+func (t *SimpleChaincode) mint(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//		 0			1
+	//	  Address	  Amount
+
+	if err := requireArgs("mint", args, 2); err != nil {
+		return errorFromErr(err)
+	}
+
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	callerID, err := getCallerID(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if config.Issuer == "" || callerID != config.Issuer {
+		return errorJSON(codeForbidden, "Only the issuer can mint funds")
+	}
+
+	address := args[0]
+	amount, err := parseAmount(args[1], config.Decimals)
+	if err != nil {
+		return errorJSON(codeBadRequest, "Failed to parse into Integer, 2nd Argument must be a numeric string: "+err.Error())
+	}
+	if amount.Sign() <= 0 {
+		return errorJSON(codeBadRequest, "mint amount must be positive")
+	}
+
+	wallet, err := getWallet(stub, address)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if wallet.Frozen {
+		return errorJSON(codeLocked, "wallet is frozen: "+address)
+	}
+
+	totalSupply, err := readTotalSupply(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	oldBalance := wallet.Balance
+	wallet.Balance = new(big.Int).Add(wallet.Balance, amount)
+	totalSupply = new(big.Int).Add(totalSupply, amount)
+
+	err = putWallet(stub, wallet)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = reindexWallet(stub, oldBalance, wallet)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = writeTotalSupply(stub, totalSupply)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	err = appendChangeLog(stub, address, "mint", amount)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = emitTransfer(stub, TransferEvent{To: address, Amount: formatAmount(amount, config.Decimals), TxID: stub.GetTxID()})
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Println(" - END mint - ")
+	return successJSON(stub, nil)
+}
+
+/*
+* burn
+* This method destroys money from a wallet, only the issuer can call it
+* It's also routed as burnFunds
+* [id]		= This is the id for the wallet losing the money
+* [amount]	= This is the amount of money being destroyed
+ */
+
+func (t *SimpleChaincode) burn(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//		 0			1
+	//	  Address	  Amount
+
+	if err := requireArgs("burn", args, 2); err != nil {
+		return errorFromErr(err)
+	}
+
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	callerID, err := getCallerID(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if config.Issuer == "" || callerID != config.Issuer {
+		return errorJSON(codeForbidden, "Only the issuer can burn funds")
+	}
+
+	address := args[0]
+	amount, err := parseAmount(args[1], config.Decimals)
+	if err != nil {
+		return errorJSON(codeBadRequest, "Failed to parse into Integer, 2nd Argument must be a numeric string: "+err.Error())
+	}
+	if amount.Sign() <= 0 {
+		return errorJSON(codeBadRequest, "burn amount must be positive")
+	}
+
+	wallet, err := getWallet(stub, address)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if wallet.Frozen {
+		return errorJSON(codeLocked, "wallet is frozen: "+address)
+	}
+	if wallet.Balance.Cmp(amount) < 0 {
+		return errorJSON(codeInsufficientFunds, "insufficient funds to burn")
+	}
+
+	totalSupply, err := readTotalSupply(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if totalSupply.Cmp(amount) < 0 {
+		return errorJSON(codeConflict, "Total supply can't go negative")
+	}
+
+	oldBalance := wallet.Balance
+	wallet.Balance = new(big.Int).Sub(wallet.Balance, amount)
+	err = putWallet(stub, wallet)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = reindexWallet(stub, oldBalance, wallet)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = writeTotalSupply(stub, new(big.Int).Sub(totalSupply, amount))
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	err = appendChangeLog(stub, address, "burn", new(big.Int).Neg(amount))
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = emitTransfer(stub, TransferEvent{From: address, Amount: formatAmount(amount, config.Decimals), TxID: stub.GetTxID()})
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Println(" - END burn - ")
+	return successJSON(stub, nil)
+}
+
+/*
+* getTotalSupply
+* This method returns the amount of money in circulation
+* (JSON)	= JSON Document with the total supply
+ */
+
+func (t *SimpleChaincode) getTotalSupply(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("getTotalSupply", args, 0); err != nil {
+		return errorFromErr(err)
+	}
+
+	totalSupply, err := readTotalSupply(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	supplyAsBytes, err := json.Marshal(struct {
+		TotalSupply string `json:"totalSupply"`
+	}{formatAmount(totalSupply, config.Decimals)})
+	if err != nil {
+		return errorFromErr(err)
+	}
+	return successJSON(stub, supplyAsBytes)
+}
+
+/*
+* sumWalletBalances
+* This method adds up the balance of every wallet on the ledger
+* Only real wallets are counted, since a range query never returns the other records
+ */
+
+func sumWalletBalances(stub shim.ChaincodeStubInterface) (*big.Int, int, error) {
+	resultsIterator, err := stub.GetStateByRange("", "")
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resultsIterator.Close()
+
+	sum := new(big.Int)
+	count := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		wallet, err := unmarshalWallet(queryResponse.Key, queryResponse.Value)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		sum.Add(sum, wallet.Balance)
+		sum.Add(sum, wallet.Held)
+		sum.Add(sum, wallet.Reserved)
+		count++
+	}
+
+	return sum, count, nil
+}
+
+/*
+* getTotalSupplyByScan
+* This method returns the amount of money in circulation by adding up every wallet instead of reading the counter
+* It's meant to catch bugs that create or destroy money, so it's expensive on large ledgers
+* (JSON)	= JSON Document with the total supply and the amount of wallets added up
+ */
+
+func (t *SimpleChaincode) getTotalSupplyByScan(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("getTotalSupplyByScan", args, 0); err != nil {
+		return errorFromErr(err)
+	}
+
+	sum, count, err := sumWalletBalances(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	supplyAsBytes, err := json.Marshal(struct {
+		TotalSupply string `json:"totalSupply"`
+		WalletCount int    `json:"walletCount"`
+	}{formatAmount(sum, config.Decimals), count})
+	if err != nil {
+		return errorFromErr(err)
+	}
+	return successJSON(stub, supplyAsBytes)
+}
+
+/*
+* auditSupply
+* This method reconciles the total supply counter against the sum of every wallet balance
+* The wallets are streamed off the range iterator, so only the running sum is kept in memory
+* (JSON)	= JSON Document with the recorded supply, the summed balances and whether they match
+ */
+
+func (t *SimpleChaincode) auditSupply(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("auditSupply", args, 0); err != nil {
+		return errorFromErr(err)
+	}
+
+	totalSupply, err := readTotalSupply(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	sum, count, err := sumWalletBalances(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Printf("- auditSupply counter %s, wallets %s over %d wallets\n", totalSupply, sum, count)
+	auditAsBytes, err := json.Marshal(struct {
+		TotalSupply string `json:"totalSupply"`
+		WalletSum   string `json:"walletSum"`
+		WalletCount int    `json:"walletCount"`
+		Match       bool   `json:"match"`
+	}{formatAmount(totalSupply, config.Decimals), formatAmount(sum, config.Decimals), count, totalSupply.Cmp(sum) == 0})
+	if err != nil {
+		return errorFromErr(err)
+	}
+	return successJSON(stub, auditAsBytes)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMint(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+
+	s.ok("mint", alice, "50")
+	s.expectBalance(alice, "150")
+	s.expectSupply("150")
+	expectMessage(t, s.as("bob").fails(codeForbidden, "mint", alice, "50"), "Only the issuer can mint funds")
+	s.fails(codeBadRequest, "mint", alice, "0")
+	s.fails(codeNotFound, "mint", addressOf("nobody"), "50")
+	s.expectSupply("150")
+}
+
+func TestBurn(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+
+	s.ok("burn", alice, "30")
+	s.expectBalance(alice, "70")
+	s.expectSupply("70")
+	expectMessage(t, s.fails(codeInsufficientFunds, "burn", alice, "71"), "insufficient funds to burn")
+	s.as("bob").fails(codeForbidden, "burn", alice, "1")
+	s.expectBalance(alice, "70")
+	s.expectSupply("70")
+}
+
+func TestMintFunds(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "0")
+
+	s.ok("mintFunds", alice, "25")
+	s.expectBalance(alice, "25")
+	s.expectSupply("25")
+	s.as("bob").fails(codeForbidden, "mintFunds", alice, "25")
+}
+
+func TestBurnFunds(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "25")
+
+	s.ok("burnFunds", alice, "25")
+	s.expectBalance(alice, "0")
+	s.expectSupply("0")
+	s.fails(codeInsufficientFunds, "burnFunds", alice, "1")
+}
+
+func TestGetTotalSupply(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	s.createWallet("bob", "50")
+	s.ok("mint", alice, "20")
+	s.ok("burn", alice, "10")
+
+	total := struct {
+		TotalSupply string `json:"totalSupply"`
+	}{}
+	decode(t, s.ok("getTotalSupply").Data, &total)
+	if total.TotalSupply != "160" {
+		t.Fatalf("getTotalSupply returned %s", total.TotalSupply)
+	}
+}
+
+func TestGetTotalSupplyByScan(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "50")
+	s.ok("transferFunds", alice, bob, "30")
+	s.ok("placeHold", bob, "20")
+
+	//Held money still belongs to the wallet, so it's part of the sum
+	total := struct {
+		TotalSupply string `json:"totalSupply"`
+	}{}
+	decode(t, s.ok("getTotalSupplyByScan").Data, &total)
+	if total.TotalSupply != "150" {
+		t.Fatalf("getTotalSupplyByScan returned %s", total.TotalSupply)
+	}
+}
+
+func TestAuditSupply(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	s.createWallet("alice", "100")
+	s.createWallet("bob", "200")
+	s.createWallet("carol", "300")
+
+	audit := struct {
+		TotalSupply string `json:"totalSupply"`
+		WalletSum   string `json:"walletSum"`
+		WalletCount int    `json:"walletCount"`
+		Match       bool   `json:"match"`
+	}{}
+	decode(t, s.ok("auditSupply").Data, &audit)
+	if audit.TotalSupply != "600" || audit.WalletSum != "600" || audit.WalletCount != 3 || !audit.Match {
+		t.Fatalf("unexpected audit %+v", audit)
+	}
+
+	s.tamper(s.compositeKey(totalSupplyIndex), []byte("999"))
+	decode(t, s.ok("auditSupply").Data, &audit)
+	if audit.TotalSupply != "999" || audit.WalletSum != "600" || audit.Match {
+		t.Fatalf("tampered counter wasn't flagged: %+v", audit)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+* setSweepConfig
+* This method configures the automatic sweep of a hot wallet, only the admin can call it
+* [id]			= This is the id for the hot wallet
+* [threshold]	= This is the balance the hot wallet gets swept down to, in the configured decimals
+* [target]		= This is the id for the cold wallet, an empty string disables the sweep
+ */
+
+func (t *SimpleChaincode) setSweepConfig(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//		 0			1			2
+	//	  Address	Threshold	  Target
+
+	if err := requireArgs("setSweepConfig", args, 3); err != nil {
+		return errorFromErr(err)
+	}
+
+	admin, err := isAdmin(stub)
+	if err != nil {
+		return errorFromErr(err)
+	} else if !admin {
+		return errorJSON(codeForbidden, "Only the admin can configure sweeps")
+	}
+
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	address := args[0]
+	threshold, err := parseAmount(args[1], config.Decimals)
+	if err != nil || threshold.Sign() < 0 {
+		return errorJSON(codeBadRequest, "2nd Argument must be a non negative numeric string")
+	}
+	target := args[2]
+
+	wallet, err := getWallet(stub, address)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	//The cold wallet has to exist beforehand and can't be the hot wallet itself
+	if target != "" {
+		if target == address {
+			return errorJSON(codeBadRequest, "A Wallet can't be swept into itself")
+		}
+		targetWallet, err := getWallet(stub, target)
+		if err != nil {
+			return errorFromErr(err)
+		}
+		if walletCurrency(config, &wallet) != walletCurrency(config, &targetWallet) {
+			return errorJSON(codeBadRequest, "currency mismatch")
+		}
+	}
+
+	wallet.SweepThreshold = threshold
+	wallet.SweepTarget = target
+	err = putWallet(stub, wallet)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Println(" - END setSweepConfig - ")
+	return successJSON(stub, nil)
+}
+
+/*
+* runSweeps
+* This method moves the balance above the threshold of every configured hot wallet to its cold wallet
+* Only the admin can call it, hot or cold wallets that are frozen are skipped
+* Sweeps are charged the transfer fee like any other transfer, out of the swept money
+* (JSON)	= JSON Document with the amount of wallets swept
+ */
+
+func (t *SimpleChaincode) runSweeps(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("runSweeps", args, 0); err != nil {
+		return errorFromErr(err)
+	}
+
+	admin, err := isAdmin(stub)
+	if err != nil {
+		return errorFromErr(err)
+	} else if !admin {
+		return errorJSON(codeForbidden, "Only the admin can run sweeps")
+	}
+
+	//Load every wallet first, the ledger doesn't return our own writes
+	//until the transaction is committed so all the math happens in memory
+	resultsIterator, err := stub.GetStateByRange("", "")
+	if err != nil {
+		return errorFromErr(err)
+	}
+	defer resultsIterator.Close()
+
+	wallets := map[string]*Wallet{}
+	addresses := []string{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return errorFromErr(err)
+		}
+
+		wallet, err := unmarshalWallet(queryResponse.Key, queryResponse.Value)
+		if err != nil {
+			return errorFromErr(err)
+		}
+		wallets[queryResponse.Key] = &wallet
+		addresses = append(addresses, queryResponse.Key)
+	}
+
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	var treasury *Wallet
+	if config.Treasury != "" {
+		var ok bool
+		treasury, ok = wallets[config.Treasury]
+		if !ok {
+			return errorJSON(codeNotFound, "Failed to load the treasury: Wallet does not exist: "+config.Treasury)
+		}
+	}
+
+	//Sweeps run in key order so every endorser gets the same result
+	deltas := map[string]*big.Int{}
+	addDelta := func(address string, delta *big.Int) {
+		if _, ok := deltas[address]; !ok {
+			deltas[address] = new(big.Int)
+		}
+		deltas[address].Add(deltas[address], delta)
+	}
+	receipts := []TransferReceipt{}
+	for _, address := range addresses {
+		wallet := wallets[address]
+		threshold := wallet.SweepThreshold
+		if wallet.SweepTarget == "" || wallet.Balance.Cmp(threshold) <= 0 {
+			continue
+		}
+
+		target, ok := wallets[wallet.SweepTarget]
+		if !ok {
+			return errorJSON(codeNotFound, "Sweep target does not exist: "+wallet.SweepTarget)
+		}
+		//Frozen Wallets can't send nor receive money, so they're left for the next run
+		if wallet.Frozen || target.Frozen {
+			continue
+		}
+
+		//The fee comes out of the excess, so the hot wallet never drops below its threshold
+		//The treasury doesn't pay fees to itself
+		excess := new(big.Int).Sub(wallet.Balance, threshold)
+		amount := excess
+		fee := new(big.Int)
+		if treasury != nil && treasury != wallet {
+			excessFee, err := computeFee(config, excess)
+			if err != nil {
+				return errorFromErr(err)
+			}
+			amount = new(big.Int).Sub(excess, excessFee)
+			fee, err = computeFee(config, amount)
+			if err != nil {
+				return errorFromErr(err)
+			}
+		}
+		if amount.Sign() <= 0 {
+			continue
+		}
+		if fee.Sign() > 0 && walletCurrency(config, treasury) != walletCurrency(config, wallet) {
+			return errorJSON(codeBadRequest, "currency mismatch with the treasury "+treasury.Address)
+		}
+
+		total := new(big.Int).Add(amount, fee)
+		wallet.Balance = new(big.Int).Sub(wallet.Balance, total)
+		target.Balance = new(big.Int).Add(target.Balance, amount)
+		addDelta(address, new(big.Int).Neg(total))
+		addDelta(wallet.SweepTarget, amount)
+		if fee.Sign() > 0 {
+			treasury.Balance = new(big.Int).Add(treasury.Balance, fee)
+			addDelta(treasury.Address, fee)
+		}
+
+		receipts = append(receipts, TransferReceipt{
+			TransferEvent: TransferEvent{From: address, To: wallet.SweepTarget, Amount: formatAmount(amount, config.Decimals), Memo: "runSweeps", TxID: stub.GetTxID()},
+			Fee:           formatAmount(fee, config.Decimals),
+			FromBalance:   formatAmount(wallet.Balance, config.Decimals),
+			ToBalance:     formatAmount(target.Balance, config.Decimals),
+		})
+	}
+
+	for _, address := range addresses {
+		delta, ok := deltas[address]
+		if !ok {
+			continue
+		}
+
+		err = putWallet(stub, *wallets[address])
+		if err != nil {
+			return errorFromErr(err)
+		}
+		err = reindexWallet(stub, new(big.Int).Sub(wallets[address].Balance, delta), *wallets[address])
+		if err != nil {
+			return errorFromErr(err)
+		}
+		err = appendChangeLog(stub, address, "runSweeps", delta)
+		if err != nil {
+			return errorFromErr(err)
+		}
+	}
+
+	//Every sweep leaves a receipt under tx~<txid>~<hot wallet>, and Fabric only keeps one event
+	//per transaction, so all of them go out together as a SweepEvent
+	events := []TransferEvent{}
+	for i := range receipts {
+		_, err = saveReceipt(stub, &receipts[i], receipts[i].TxID, receipts[i].From)
+		if err != nil {
+			return errorFromErr(err)
+		}
+		events = append(events, receipts[i].TransferEvent)
+	}
+	if len(events) > 0 {
+		eventsAsBytes, err := json.Marshal(events)
+		if err != nil {
+			return errorFromErr(err)
+		}
+		err = stub.SetEvent("SweepEvent", eventsAsBytes)
+		if err != nil {
+			return errorFromErr(err)
+		}
+	}
+	swept := len(receipts)
+
+	fmt.Printf(" - END runSweeps (%d swept) - \n", swept)
+	return successJSON(stub, []byte("{\"swept\":"+strconv.Itoa(swept)+"}"))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSweeps(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	hot := s.createWallet("hot", "150")
+	warm := s.createWallet("warm", "80")
+	frozen := s.createWallet("frozen", "500")
+	cold := s.createWallet("cold", "0")
+
+	s.as("bob").fails(codeForbidden, "setSweepConfig", hot, "100", cold)
+	s.fails(codeBadRequest, "setSweepConfig", hot, "100", hot)
+	s.ok("setSweepConfig", hot, "100", cold)
+	s.ok("setSweepConfig", warm, "100", cold)
+	s.ok("setSweepConfig", frozen, "100", cold)
+	s.ok("freezeWallet", frozen)
+
+	s.as("bob").fails(codeForbidden, "runSweeps")
+	swept := struct {
+		Swept int `json:"swept"`
+	}{}
+	response := s.ok("runSweeps")
+	decode(t, response.Data, &swept)
+	if swept.Swept != 1 {
+		t.Fatalf("swept %d wallets instead of 1", swept.Swept)
+	}
+	s.expectBalance(hot, "100")
+	s.expectBalance(warm, "80")
+	s.expectBalance(frozen, "500")
+	s.expectBalance(cold, "50")
+	s.expectSupply("730")
+
+	events := []TransferEvent{}
+	s.expectEvent("SweepEvent", &events)
+	if len(events) != 1 || events[0].From != hot || events[0].To != cold || events[0].Amount != "50" {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	receipt := TransferReceipt{}
+	decode(t, s.State[s.compositeKey(transferRecordIndex, response.TxID, hot)], &receipt)
+	if receipt.Amount != "50" || receipt.FromBalance != "100" {
+		t.Fatalf("unexpected receipt %+v", receipt)
+	}
+
+	//Nothing is left above the threshold
+	decode(t, s.ok("runSweeps").Data, &swept)
+	if swept.Swept != 0 {
+		t.Fatalf("swept %d wallets twice", swept.Swept)
+	}
+}
+
+func TestSweepFees(t *testing.T) {
+	treasury := addressOf("treasury")
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY", Treasury: treasury, FeeFlat: "1"})
+	s.createWallet("treasury", "0")
+	hot := s.createWallet("hot", "150")
+	cold := s.createWallet("cold", "0")
+	s.ok("setSweepConfig", hot, "100", cold)
+
+	s.ok("runSweeps")
+	//The fee comes out of the swept money, so the hot wallet still ends at its threshold
+	s.expectBalance(hot, "100")
+	s.expectBalance(cold, "49")
+	s.expectBalance(treasury, "1")
+	s.expectSupply("150")
+}
+
+func TestSweepThresholdPastInt64(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	hot := s.createWallet("hot", "0")
+	cold := s.createWallet("cold", "0")
+
+	s.ok("setSweepConfig", hot, "18446744073709551616", cold)
+	if threshold := s.wallet(hot).SweepThreshold.String(); threshold != "18446744073709551616" {
+		t.Fatalf("threshold is %s", threshold)
+	}
+	s.fails(codeBadRequest, "setSweepConfig", hot, "-1", cold)
+}
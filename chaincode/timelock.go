@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Time locks are keyed by the transaction that created them (timelock~<txid>) so they never collide with wallets
+const timeLockIndex = "timelock"
+
+/*
+* Define the TimeLock Structure, it's money a sender set aside for a receiver that can't be claimed before a time
+* The money stays reserved in the sending wallet, apart from its holds, until it's claimed, so it's still counted in the supply
+* [ID] <-- Transaction that created the time lock
+* [From] <-- Wallet the money is reserved in
+* [To] <-- Wallet that receives the money once it unlocks
+* [Amount] <-- Amount of money locked
+* [Memo] <-- Reason for the payment, it becomes the memo of the transfer when it's claimed
+* [UnlockAt] <-- RFC3339 timestamp from which the money can be claimed
+* [Claimed] <-- Flag that indicates the money was already paid out
+* [CreatedAt] <-- RFC3339 timestamp of the transaction that created the time lock
+ */
+type TimeLock struct {
+	ID        string   `json:"id"`
+	From      string   `json:"from"`
+	To        string   `json:"to"`
+	Amount    *big.Int `json:"amount"`
+	Memo      string   `json:"memo,omitempty"`
+	UnlockAt  string   `json:"unlockAt"`
+	Claimed   bool     `json:"claimed"`
+	CreatedAt string   `json:"createdAt"`
+}
+
+/*
+* MarshalJSON
+* This method saves a time lock with the amount it keeps until the unlock time
+ */
+
+func (l TimeLock) MarshalJSON() ([]byte, error) {
+	type storedTimeLock TimeLock
+	return json.Marshal(struct {
+		Amount string `json:"amount"`
+		storedTimeLock
+	}{storedAmount(l.Amount), storedTimeLock(l)})
+}
+
+/*
+* UnmarshalJSON
+* This method reads a time lock back from the ledger
+ */
+
+func (l *TimeLock) UnmarshalJSON(data []byte) error {
+	type storedTimeLock TimeLock
+	stored := struct {
+		*storedTimeLock
+		Amount json.RawMessage `json:"amount"`
+	}{storedTimeLock: (*storedTimeLock)(l)}
+	err := json.Unmarshal(data, &stored)
+	if err != nil {
+		return err
+	}
+
+	l.Amount, err = loadStoredAmount("amount", stored.Amount)
+	return err
+}
+
+/*
+* createTimeLock
+* This method locks money of a wallet for another wallet until a time, it follows the same rules as a transfer
+* [from]	= This is the id for the wallet the money is locked in
+* [to]		= This is the id for the wallet that can claim it
+* [amount]	= This is the amount of money locked
+* [unlockAt]	= This is the RFC3339 timestamp from which it can be claimed, e.g. 2018-01-31T00:00:00Z
+* [memo]	= (Optional) This is the reason for the payment, required above the memo threshold like a transfer
+* (JSON)	= JSON Document with the id of the time lock
+ */
+
+func (t *SimpleChaincode) createTimeLock(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//		 0			1		2			3		4
+	//		from		to	  amount	 unlockAt	memo
+
+	if err := requireArgsBetween("createTimeLock", args, 4, 5); err != nil {
+		return errorFromErr(err)
+	}
+
+	from := args[0]
+	to := args[1]
+	memo := ""
+	if len(args) > 4 {
+		memo = strings.TrimSpace(args[4])
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	amount, err := parseAmount(args[2], config.Decimals)
+	if err != nil {
+		return errorJSON(codeBadRequest, "Failed to parse into Integer, 3rd Argument must be a numeric string: "+err.Error())
+	}
+	unlockAt, err := time.Parse(time.RFC3339, args[3])
+	if err != nil {
+		return errorJSON(codeBadRequest, "4th Argument must be an RFC3339 timestamp: "+err.Error())
+	}
+
+	//The time comes from the transaction so every endorser agrees on it
+	now, err := getTxTime(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if !unlockAt.After(now) {
+		return errorJSON(codeBadRequest, "unlockAt must be in the future")
+	}
+
+	walletFrom, err := getWallet(stub, from)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	walletTo, err := getWallet(stub, to)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	callerID, err := getCallerID(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = checkTransfer(config, callerID, &walletFrom, &walletTo, amount, memo)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if config.EnforceOwnerAuth && callerID != walletFrom.Owner {
+		return errorJSON(codeForbidden, "caller is not the wallet owner")
+	}
+	if walletFrom.Balance.Cmp(amount) < 0 {
+		return errorJSON(codeInsufficientFunds, "Insufficient funds to create the time lock")
+	}
+
+	//The money moves to the reserved balance of the sender, where neither transfers nor holds can reach it
+	oldBalance := walletFrom.Balance
+	walletFrom.Balance = new(big.Int).Sub(walletFrom.Balance, amount)
+	walletFrom.Reserved = new(big.Int).Add(walletFrom.Reserved, amount)
+	err = saveWallet(stub, oldBalance, walletFrom, "createTimeLock")
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	timeLock := TimeLock{ID: stub.GetTxID(), From: from, To: to, Amount: amount, Memo: memo, UnlockAt: unlockAt.UTC().Format(time.RFC3339)}
+	timeLock.CreatedAt = now.Format(time.RFC3339)
+	err = putTimeLock(stub, timeLock)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Println(" - END createTimeLock - ")
+	return successJSON(stub, []byte("{\"timeLockId\":"+strconv.Quote(timeLock.ID)+"}"))
+}
+
+/*
+* claimTimeLock
+* This method pays an unlocked time lock out to its receiver, anyone can call it since the money only goes one way
+* The payout follows the same rules as a transfer and counts against the daily limit of the sender
+* No transfer fee is charged, so whoever claims it never spends the sender's free balance
+* [lockId]	= This is the id of the time lock
+* (JSON)	= JSON Document with the receipt of the transfer
+ */
+
+func (t *SimpleChaincode) claimTimeLock(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("claimTimeLock", args, 1); err != nil {
+		return errorFromErr(err)
+	}
+
+	timeLock, err := getTimeLock(stub, args[0])
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if timeLock.Claimed {
+		return errorJSON(codeConflict, "time lock "+timeLock.ID+" was already claimed")
+	}
+
+	unlockAt, err := time.Parse(time.RFC3339, timeLock.UnlockAt)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	now, err := getTxTime(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if now.Before(unlockAt) {
+		return errorJSON(codeLocked, "time lock "+timeLock.ID+" can't be claimed before "+timeLock.UnlockAt)
+	}
+
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	walletFrom, err := getWallet(stub, timeLock.From)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	walletTo, err := getWallet(stub, timeLock.To)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	callerID, err := getCallerID(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = checkTransfer(config, callerID, &walletFrom, &walletTo, timeLock.Amount, timeLock.Memo)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	if walletFrom.Reserved.Cmp(timeLock.Amount) < 0 {
+		return errorJSON(codeConflict, "wallet "+timeLock.From+" no longer reserves the money of time lock "+timeLock.ID)
+	}
+	err = spendDailyLimit(stub, timeLock.From, timeLock.Amount, config.Decimals)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	//The reserved money already left the balance of the sender, so only the receiver's balance moves
+	walletFrom.Reserved = new(big.Int).Sub(walletFrom.Reserved, timeLock.Amount)
+	oldBalance := walletTo.Balance
+	walletTo.Balance = new(big.Int).Add(walletTo.Balance, timeLock.Amount)
+
+	err = saveWallet(stub, walletFrom.Balance, walletFrom, "claimTimeLock")
+	if err != nil {
+		return errorFromErr(err)
+	}
+	err = saveWallet(stub, oldBalance, walletTo, "claimTimeLock")
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	timeLock.Claimed = true
+	err = putTimeLock(stub, timeLock)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	receipt := TransferReceipt{
+		TransferEvent: TransferEvent{From: timeLock.From, To: timeLock.To, Amount: formatAmount(timeLock.Amount, config.Decimals), Memo: timeLockMemo(timeLock), TxID: stub.GetTxID()},
+		Fee:           formatAmount(new(big.Int), config.Decimals),
+		FromBalance:   formatAmount(walletFrom.Balance, config.Decimals),
+		ToBalance:     formatAmount(walletTo.Balance, config.Decimals),
+	}
+	receiptAsBytes, err := recordTransfer(stub, receipt)
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	fmt.Println(" - END claimTimeLock - ")
+	return successJSON(stub, receiptAsBytes)
+}
+
+/*
+* timeLockMemo
+* This method returns the memo the claim of a time lock is recorded with, the time lock id when the sender gave none
+ */
+
+func timeLockMemo(timeLock TimeLock) string {
+	if timeLock.Memo != "" {
+		return timeLock.Memo
+	}
+	return "timelock " + timeLock.ID
+}
+
+/*
+* getTimeLock
+* This method reads a time lock from the ledger
+ */
+
+func getTimeLock(stub shim.ChaincodeStubInterface, id string) (TimeLock, error) {
+	timeLock := TimeLock{}
+	timeLockKey, err := stub.CreateCompositeKey(timeLockIndex, []string{id})
+	if err != nil {
+		return timeLock, err
+	}
+
+	timeLockAsBytes, err := stub.GetState(timeLockKey)
+	if err != nil {
+		return timeLock, fmt.Errorf("Failed to get time lock: %s", err.Error())
+	} else if timeLockAsBytes == nil {
+		return timeLock, newError(codeNotFound, "Time lock does not exist: %s", id)
+	}
+
+	err = json.Unmarshal(timeLockAsBytes, &timeLock)
+	return timeLock, err
+}
+
+/*
+* putTimeLock
+* This method saves a time lock to the ledger
+ */
+
+func putTimeLock(stub shim.ChaincodeStubInterface, timeLock TimeLock) error {
+	timeLockKey, err := stub.CreateCompositeKey(timeLockIndex, []string{timeLock.ID})
+	if err != nil {
+		return err
+	}
+
+	timeLockAsBytes, err := json.Marshal(timeLock)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(timeLockKey, timeLockAsBytes)
+}
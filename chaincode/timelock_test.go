@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeLock(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "0")
+
+	s.fails(codeBadRequest, "createTimeLock", alice, bob, "25", s.now.Add(-time.Hour).Format(time.RFC3339))
+	s.fails(codeBadRequest, "createTimeLock", alice, bob, "25", "tomorrow")
+
+	unlockAt := s.now.Add(time.Hour).Format(time.RFC3339)
+	created := struct {
+		TimeLockID string `json:"timeLockId"`
+	}{}
+	decode(t, s.ok("createTimeLock", alice, bob, "25", unlockAt).Data, &created)
+	wallet := s.wallet(alice)
+	if wallet.Balance.String() != "75" || wallet.Reserved.String() != "25" {
+		t.Fatalf("time lock left %s and %s reserved", wallet.Balance, wallet.Reserved)
+	}
+
+	expectMessage(t, s.as("bob").fails(codeLocked, "claimTimeLock", created.TimeLockID), "can't be claimed before "+unlockAt)
+	s.expectBalance(bob, "0")
+
+	s.now = s.now.Add(2 * time.Hour)
+	receipt := TransferReceipt{}
+	decode(t, s.as("bob").ok("claimTimeLock", created.TimeLockID).Data, &receipt)
+	if receipt.Memo != "timelock "+created.TimeLockID || receipt.Amount != "25" {
+		t.Fatalf("unexpected receipt %+v", receipt)
+	}
+	s.expectBalance(bob, "25")
+	if reserved := s.wallet(alice).Reserved; reserved.Sign() != 0 {
+		t.Fatalf("%s still reserved after the claim", reserved)
+	}
+	s.as("bob").fails(codeConflict, "claimTimeLock", created.TimeLockID)
+	s.fails(codeNotFound, "claimTimeLock", "tx9999")
+	s.expectBalance(bob, "25")
+	s.expectSupply("100")
+}
+
+func TestTimeLockClaimIsFeeExempt(t *testing.T) {
+	treasury := addressOf("treasury")
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY", Treasury: treasury, FeeFlat: "1", FeeBasisPoints: 100})
+	s.createWallet("treasury", "0")
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "0")
+
+	created := struct {
+		TimeLockID string `json:"timeLockId"`
+	}{}
+	decode(t, s.ok("createTimeLock", alice, bob, "100", s.now.Add(time.Hour).Format(time.RFC3339)).Data, &created)
+	s.now = s.now.Add(2 * time.Hour)
+	receipt := TransferReceipt{}
+	decode(t, s.as("bob").ok("claimTimeLock", created.TimeLockID).Data, &receipt)
+	if receipt.Fee != "0" || receipt.ToBalance != "100" {
+		t.Fatalf("unexpected receipt %+v", receipt)
+	}
+	s.expectBalance(alice, "0")
+	s.expectBalance(treasury, "0")
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+* Define the TransferEvent Structure, it's emitted and logged for every transfer, mint and burn
+* Its fields are a stable schema for indexers, new ones may be added but never renamed
+* Amounts are decimal strings in the configured decimals, e.g. "10.50", so clients that read numbers as doubles don't lose precision
+* [From] <-- Wallet that sent the money, empty when it was minted
+* [To] <-- Wallet that received the money, empty when it was burned
+* [Amount] <-- Amount of money transfered
+* [Memo] <-- Reference attached to the transfer, if any
+* [TxID] <-- Transaction that made the transfer
+ */
+type TransferEvent struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Amount string `json:"amount"`
+	Memo   string `json:"memo,omitempty"`
+	TxID   string `json:"txId"`
+}
+
+/*
+* Define the TransferReceipt Structure, it's the record a transfer leaves on the ledger
+* [TransferEvent] <-- Everything the TransferEvent carries
+* [Caller] <-- Identity that submitted the transfer
+* [Timestamp] <-- RFC3339 timestamp of the transaction
+* [Fee] <-- Fee the sender paid to the treasury on top of the amount
+* [FromBalance] <-- Balance of the sending wallet after the transfer
+* [ToBalance] <-- Balance of the receiving wallet after the transfer
+ */
+type TransferReceipt struct {
+	TransferEvent
+	Caller      string `json:"caller"`
+	Timestamp   string `json:"timestamp"`
+	Fee         string `json:"fee"`
+	FromBalance string `json:"fromBalance"`
+	ToBalance   string `json:"toBalance"`
+}
+
+// Transfer receipts are keyed by transaction (tx~<txid>) so they never collide with wallets
+const transferRecordIndex = "tx"
+
+// Idempotent transfers leave the txid that made them under their key (idem~<key>) so retries can be recognized
+const idempotencyIndex = "idem"
+
+/*
+* recordTransfer
+* This method saves the receipt of a transfer and emits it as a TransferEvent
+* ([]byte)	= The receipt as saved, so it can be handed back to the caller
+ */
+
+func recordTransfer(stub shim.ChaincodeStubInterface, receipt TransferReceipt) ([]byte, error) {
+	receiptAsBytes, err := saveReceipt(stub, &receipt, receipt.TxID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = emitTransfer(stub, receipt.TransferEvent)
+	if err != nil {
+		return nil, err
+	}
+	return receiptAsBytes, nil
+}
+
+/*
+* saveReceipt
+* This method stamps a receipt with the caller and time of the transaction and saves it under tx~<keyParts>
+* Transactions that make several transfers add a part per transfer, so their receipts don't overwrite each other
+ */
+
+func saveReceipt(stub shim.ChaincodeStubInterface, receipt *TransferReceipt, keyParts ...string) ([]byte, error) {
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	callerID, err := getCallerID(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt.Caller = callerID
+	receipt.Timestamp = timestamp
+	receiptAsBytes, err := json.Marshal(receipt)
+	if err != nil {
+		return nil, err
+	}
+
+	transferRecordKey, err := stub.CreateCompositeKey(transferRecordIndex, keyParts)
+	if err != nil {
+		return nil, err
+	}
+	err = stub.PutState(transferRecordKey, receiptAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	return receiptAsBytes, nil
+}
+
+/*
+* emitTransfer
+* This method sets the TransferEvent of the transaction, Fabric only keeps one event per transaction
+ */
+
+func emitTransfer(stub shim.ChaincodeStubInterface, event TransferEvent) error {
+	eventAsBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return stub.SetEvent("TransferEvent", eventAsBytes)
+}
+
+/*
+* creditTreasury
+* This method saves the treasury and logs the fee it collected, unless it's the sender or receiver which get saved with the transfer
+ */
+
+func creditTreasury(stub shim.ChaincodeStubInterface, treasury *Wallet, from *Wallet, to *Wallet, fee *big.Int) error {
+	if treasury == nil || fee.Sign() == 0 || treasury == from || treasury == to {
+		return nil
+	}
+
+	err := putWallet(stub, *treasury)
+	if err != nil {
+		return fmt.Errorf("Error saving the state of the treasury %s: %s", treasury.Address, err.Error())
+	}
+	err = reindexWallet(stub, new(big.Int).Sub(treasury.Balance, fee), *treasury)
+	if err != nil {
+		return err
+	}
+	return appendChangeLog(stub, treasury.Address, "fee", fee)
+}
+
+/*
+* getReceipt
+* This method returns the receipt a transfer left on the ledger, also routed as getTransaction
+* [txId]	= This is the id for the transaction that made the transfer
+* (JSON)	= JSON Document with the receipt
+ */
+
+func (t *SimpleChaincode) getReceipt(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("getReceipt", args, 1); err != nil {
+		return errorFromErr(err)
+	}
+
+	txID := args[0]
+	transferRecordKey, err := stub.CreateCompositeKey(transferRecordIndex, []string{txID})
+	if err != nil {
+		return errorFromErr(err)
+	}
+
+	receiptAsBytes, err := stub.GetState(transferRecordKey)
+	if err != nil {
+		return errorJSON(codeInternal, "Failed to get receipt: "+err.Error())
+	} else if receiptAsBytes == nil {
+		return errorJSON(codeNotFound, "Receipt does not exist: "+txID)
+	}
+
+	return successJSON(stub, receiptAsBytes)
+}
+
+/*
+* getTransactionsByRange
+* This method returns the transfer receipts whose txid falls in the given range
+* [startTxId]	= This is the first txid of the range, empty to start at the beginning
+* [endTxId]	= This is the txid the range stops before, empty to run to the end
+* (JSON)	= JSON Array with the receipts
+ */
+
+func (t *SimpleChaincode) getTransactionsByRange(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if err := requireArgs("getTransactionsByRange", args, 2); err != nil {
+		return errorFromErr(err)
+	}
+
+	startTxID := args[0]
+	endTxID := args[1]
+
+	//Receipts live under composite keys, which GetStateByRange refuses, so the range is applied over the index
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(transferRecordIndex, []string{})
+	if err != nil {
+		return errorFromErr(err)
+	}
+	defer resultsIterator.Close()
+
+	//Buffer is a JSON Array containing the receipts in the range
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+
+	bArrayMemberAlreadyWritten := false
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return errorFromErr(err)
+		}
+
+		_, keyParts, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return errorFromErr(err)
+		}
+		txID := keyParts[0]
+		if txID < startTxID {
+			continue
+		}
+		if endTxID != "" && txID >= endTxID {
+			break
+		}
+
+		writeQueryRecord(&buffer, txID, queryResponse.Value, bArrayMemberAlreadyWritten)
+		bArrayMemberAlreadyWritten = true
+	}
+	buffer.WriteString("]")
+
+	fmt.Printf("- getTransactionsByRange queryResult:\n%s\n", buffer.String())
+	return successJSON(stub, buffer.Bytes())
+}
+
+/*
+* transferFundsIdempotent
+* This method is transferFunds for clients that retry, a key that already made a transfer answers its receipt again
+* Reusing a key for a different transfer is a conflict, so a mistaken key never hides a payment
+* [from]	= This is the id for a wallet that's sending money
+* [to]		= This is the id for a wallet that's receiving money
+* [balance]	= This is the amount of money that it's being transfered
+* [key]		= This is an idempotency key chosen by the client, unique per transfer
+* [memo]	= (Optional) This is the reason or reference for the transfer, it's kept on the transfer record
+* (JSON)	= JSON Document with the receipt, carrying the txid and both new balances
+ */
+
+func (t *SimpleChaincode) transferFundsIdempotent(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//		 0			1		   2		3		4
+	//		from		to		balance		key		memo
+
+	if err := requireArgsBetween("transferFundsIdempotent", args, 4, 5); err != nil {
+		return errorFromErr(err)
+	}
+	if err := requireNonEmpty(args[:4]...); err != nil {
+		return errorFromErr(err)
+	}
+
+	idempotencyKey, err := stub.CreateCompositeKey(idempotencyIndex, []string{args[3]})
+	if err != nil {
+		return errorFromErr(err)
+	}
+	txIDAsBytes, err := stub.GetState(idempotencyKey)
+	if err != nil {
+		return errorJSON(codeInternal, "Failed to get idempotency key: "+err.Error())
+	} else if txIDAsBytes != nil {
+		return replayTransfer(stub, args, string(txIDAsBytes))
+	}
+
+	response := t.transferFunds(stub, append([]string{args[0], args[1], args[2]}, args[4:]...))
+	if response.Status != shim.OK {
+		return response
+	}
+
+	err = stub.PutState(idempotencyKey, []byte(stub.GetTxID()))
+	if err != nil {
+		return errorFromErr(err)
+	}
+	return response
+}
+
+/*
+* replayTransfer
+* This method answers a retried idempotent transfer with the receipt of the transfer its key already made
+ */
+
+func replayTransfer(stub shim.ChaincodeStubInterface, args []string, txID string) pb.Response {
+	transferRecordKey, err := stub.CreateCompositeKey(transferRecordIndex, []string{txID})
+	if err != nil {
+		return errorFromErr(err)
+	}
+	receiptAsBytes, err := stub.GetState(transferRecordKey)
+	if err != nil {
+		return errorJSON(codeInternal, "Failed to get receipt: "+err.Error())
+	} else if receiptAsBytes == nil {
+		return errorJSON(codeNotFound, "Receipt does not exist: "+txID)
+	}
+
+	receipt := TransferReceipt{}
+	err = json.Unmarshal(receiptAsBytes, &receipt)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorFromErr(err)
+	}
+	amount, err := parseAmount(args[2], config.Decimals)
+	if err != nil {
+		return errorJSON(codeBadRequest, "Failed to parse into Integer, 3rd Argument must be a numeric string: "+err.Error())
+	}
+	if receipt.From != args[0] || receipt.To != args[1] || receipt.Amount != formatAmount(amount, config.Decimals) {
+		return errorJSON(codeConflict, "idempotency key "+args[3]+" was already used for transfer "+txID)
+	}
+
+	fmt.Println(" - END Transaction (replayed) - ")
+	return successJSON(stub, receiptAsBytes)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTransferMemo(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "0")
+
+	response := s.ok("transferFunds", alice, bob, "10", "invoice 42")
+	event := TransferEvent{}
+	s.expectEvent("TransferEvent", &event)
+	if event.Memo != "invoice 42" || event.TxID != response.TxID || event.Amount != "10" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+
+	//The memo is optional, and capped in length
+	s.ok("transferFunds", alice, bob, "10")
+	plain := TransferEvent{}
+	s.expectEvent("TransferEvent", &plain)
+	if plain.Memo != "" {
+		t.Fatalf("transfer without a memo carries %q", plain.Memo)
+	}
+	s.fails(codeBadRequest, "transferFunds", alice, bob, "10", strings.Repeat("m", maxMemoLength+1))
+	s.expectBalance(bob, "20")
+}
+
+func TestTransferReceipt(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "50")
+
+	response := s.ok("transferFunds", alice, bob, "30", "invoice 42")
+	receipt := TransferReceipt{}
+	decode(t, response.Data, &receipt)
+	if receipt.From != alice || receipt.To != bob || receipt.Amount != "30" || receipt.FromBalance != "70" || receipt.ToBalance != "80" || receipt.Fee != "0" {
+		t.Fatalf("unexpected receipt %+v", receipt)
+	}
+	if receipt.TxID != response.TxID {
+		t.Fatalf("receipt txid %s doesn't match the response txid %s", receipt.TxID, response.TxID)
+	}
+
+	stored := TransferReceipt{}
+	decode(t, s.ok("getReceipt", response.TxID).Data, &stored)
+	if stored != receipt || stored.Caller != s.idOf("admin") || stored.Timestamp == "" {
+		t.Fatalf("stored receipt %+v doesn't match %+v", stored, receipt)
+	}
+	decode(t, s.ok("getTransaction", response.TxID).Data, &stored)
+	if stored.Memo != "invoice 42" {
+		t.Fatalf("unexpected receipt %+v", stored)
+	}
+	s.fails(codeNotFound, "getReceipt", "tx9999")
+}
+
+func TestEventFields(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "0")
+
+	fieldsOf := func(name string) map[string]interface{} {
+		fields := map[string]interface{}{}
+		s.expectEvent(name, &fields)
+		return fields
+	}
+	expectFields := func(fields map[string]interface{}, expected map[string]interface{}) {
+		t.Helper()
+		if len(fields) != len(expected) {
+			t.Fatalf("event has fields %v, expected %v", fields, expected)
+		}
+		for field, value := range expected {
+			if fields[field] != value {
+				t.Fatalf("event field %s is %v, expected %v", field, fields[field], value)
+			}
+		}
+	}
+
+	response := s.ok("transferFunds", alice, bob, "25", "rent")
+	expectFields(fieldsOf("TransferEvent"), map[string]interface{}{"from": alice, "to": bob, "amount": "25", "memo": "rent", "txId": response.TxID})
+
+	response = s.ok("mint", bob, "5")
+	expectFields(fieldsOf("TransferEvent"), map[string]interface{}{"from": "", "to": bob, "amount": "5", "txId": response.TxID})
+
+	response = s.ok("burn", bob, "5")
+	expectFields(fieldsOf("TransferEvent"), map[string]interface{}{"from": bob, "to": "", "amount": "5", "txId": response.TxID})
+
+	response = s.ok("approve", alice, "spender", "7")
+	expectFields(fieldsOf("ApprovalEvent"), map[string]interface{}{"owner": alice, "spender": "spender", "amount": "7", "txId": response.TxID})
+}
+
+func TestIdempotentTransfer(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "0")
+
+	first := s.ok("transferFundsIdempotent", alice, bob, "10", "key-1")
+	replay := s.ok("transferFundsIdempotent", alice, bob, "10", "key-1")
+	if string(first.Data) != string(replay.Data) {
+		t.Fatalf("replay answered %s instead of %s", replay.Data, first.Data)
+	}
+	s.expectBalance(alice, "90")
+	s.expectBalance(bob, "10")
+
+	expectMessage(t, s.fails(codeConflict, "transferFundsIdempotent", alice, bob, "20", "key-1"), "idempotency key key-1 was already used for transfer "+first.TxID)
+	s.ok("transferFundsIdempotent", alice, bob, "20", "key-2")
+	s.expectBalance(alice, "70")
+
+	//A failed transfer doesn't use up its key
+	s.fails(codeInsufficientFunds, "transferFundsIdempotent", alice, bob, "500", "key-3")
+	s.ok("transferFundsIdempotent", alice, bob, "5", "key-3")
+	s.expectBalance(alice, "65")
+}
+
+func TestGetTransactionsByRange(t *testing.T) {
+	s := newTestStub(t)
+	s.instantiate(Config{Name: "Halley Coin", Symbol: "HLY"})
+	alice := s.createWallet("alice", "100")
+	bob := s.createWallet("bob", "0")
+
+	first := s.ok("transferFunds", alice, bob, "10")
+	second := s.ok("transferFunds", alice, bob, "5", "invoice 43")
+
+	records := []struct {
+		Key    string          `json:"Key"`
+		Record TransferReceipt `json:"Record"`
+	}{}
+	decode(t, s.ok("getTransactionsByRange", "", "").Data, &records)
+	if len(records) != 2 || records[0].Key != first.TxID || records[1].Key != second.TxID {
+		t.Fatalf("unexpected receipts %+v", records)
+	}
+	if records[0].Record.From != alice || records[0].Record.To != bob || records[0].Record.Amount != "10" {
+		t.Fatalf("unexpected receipt %+v", records[0].Record)
+	}
+	decode(t, s.ok("getTransactionsByRange", second.TxID, "").Data, &records)
+	if len(records) != 1 || records[0].Record.Memo != "invoice 43" {
+		t.Fatalf("unexpected receipts %+v", records)
+	}
+}